@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -42,6 +43,11 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 	app.errorResonse(w, r, http.StatusBadRequest, err.Error())
 }
 
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the request body must be one of: %s", strings.Join(supported, ", "))
+	app.errorResonse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResonse(w, r, http.StatusUnprocessableEntity, errors)
 }
@@ -51,6 +57,23 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResonse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, existingID int64) {
+	message := map[string]interface{}{
+		"message":           "a movie with this title and year already exists, pass force=true to create it anyway",
+		"existing_movie_id": existingID,
+	}
+	app.errorResonse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since the version given in If-Match"
+	app.errorResonse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResonse(w, r, http.StatusConflict, err.Error())
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeds"
 	app.errorResonse(w, r, http.StatusTooManyRequests, message)
@@ -81,3 +104,13 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permission to access this resource"
 	app.errorResonse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the idempotency key has already been used for a different request"
+	app.errorResonse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with the same idempotency key is still being processed, please try again later"
+	app.errorResonse(w, r, http.StatusConflict, message)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+)
+
+// exportFlushInterval is the number of rows written between flushes of the
+// response to the client.
+const exportFlushInterval = 100
+
+// exportWriteTimeout is how long each flush of an export has to reach the
+// client. The server's WriteTimeout would otherwise cut off exports which
+// take longer than that in total.
+const exportWriteTimeout = 30 * time.Second
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	format := app.readString(qs, "format", "ndjson")
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be either csv or ndjson")
+
+	filters := app.readMovieFilters(qs, v)
+
+	err := app.normaliseGenreFilters(v, &filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var writeHeader, flushRows func() error
+	var writeRow func(*data.Movie) error
+
+	runtimeFormat := app.contextGetRuntimeFormat(r)
+
+	switch format {
+	case "csv":
+		// Runtimes are whole numbers of minutes in CSV unless another format
+		// is asked for.
+		if runtimeFormat == "" {
+			runtimeFormat = data.RuntimeMinutes
+		}
+
+		cw := csv.NewWriter(w)
+		writeHeader = func() error {
+			return cw.Write([]string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count"})
+		}
+		writeRow = func(movie *data.Movie) error {
+			averageRating := ""
+			if movie.AverageRating != nil {
+				averageRating = strconv.FormatFloat(*movie.AverageRating, 'f', 2, 64)
+			}
+
+			return cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.Title,
+				strconv.FormatInt(int64(movie.Year), 10),
+				movie.Runtime.FormatAs(runtimeFormat),
+				strings.Join(movie.Genres, "|"),
+				strconv.FormatInt(int64(movie.Version), 10),
+				averageRating,
+				strconv.FormatInt(int64(movie.RatingCount), 10),
+			})
+		}
+		flushRows = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		w.Header().Set("Content-Type", "text/csv")
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		writeHeader = func() error {
+			return nil
+		}
+		writeRow = func(movie *data.Movie) error {
+			movie.RuntimeFormat = runtimeFormat
+			return enc.Encode(movie)
+		}
+		flushRows = func() error {
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	rc := http.NewResponseController(w)
+	written := 0
+	started := false
+
+	// The header and status are only sent with the first row, so that a query
+	// which fails straight away can still get a proper error response. Once
+	// they are sent, a failure can only be logged and the stream cut short.
+	start := func() error {
+		if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=movies."+format)
+		w.WriteHeader(http.StatusOK)
+		started = true
+		return writeHeader()
+	}
+
+	err = app.models.Movies.Export(r.Context(), filters, func(movie *data.Movie) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		err := writeRow(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushInterval == 0 {
+			if err := flushRows(); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+			if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+		} else {
+			app.logError(r, err)
+		}
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			if !started {
+				app.serverErrorResponse(w, r, err)
+			} else {
+				app.logError(r, err)
+			}
+			return
+		}
+	}
+
+	err = flushRows()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// normaliseGenres replaces the genres of a movie with their canonical names
+// from the genre catalogue, adding a validation error for any it does not
+// know.
+func (app *application) normaliseGenres(v *validator.Validator, movie *data.Movie) error {
+	catalogue, err := app.models.Genres.Catalogue()
+	if err != nil {
+		return err
+	}
+
+	movie.Genres = catalogue.Normalise(v, "genres", movie.Genres)
+	return nil
+}
+
+// normaliseGenreFilters replaces the genres movies are filtered by with their
+// canonical names, since those are the only names movies are saved with.
+func (app *application) normaliseGenreFilters(v *validator.Validator, filters *data.MovieFilters) error {
+	if len(filters.Genres) == 0 && len(filters.ExcludeGenres) == 0 {
+		return nil
+	}
+
+	catalogue, err := app.models.Genres.Catalogue()
+	if err != nil {
+		return err
+	}
+
+	filters.Genres = catalogue.Normalise(v, "genres", filters.Genres)
+	filters.ExcludeGenres = catalogue.Normalise(v, "exclude_genres", filters.ExcludeGenres)
+	return nil
+}
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := app.models.Genres.GetBySlug(httprouter.ParamsFromContext(r.Context()).ByName("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Name:    input.Name,
+		Slug:    data.GenreSlug(input.Name),
+		Aliases: []string{},
+	}
+	for _, alias := range input.Aliases {
+		genre.Aliases = append(genre.Aliases, data.GenreSlug(alias))
+	}
+
+	v := validator.New()
+
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("name", "a genre with this name or one of these aliases already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%s", genre.Slug))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) mergeGenresHandler(w http.ResponseWriter, r *http.Request) {
+	from, err := app.models.Genres.GetBySlug(httprouter.ParamsFromContext(r.Context()).ByName("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Into string `json:"into"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Into != "", "into", "must be provided")
+	v.Check(data.GenreSlug(input.Into) != from.Slug, "into", "must be a different genre")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	into, err := app.models.Genres.GetBySlug(data.GenreSlug(input.Into))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "no such genre")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rewritten, err := app.models.Genres.Merge(from, into, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	into, err = app.models.Genres.GetBySlug(into.Slug)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"genre": into, "movies_rewritten": rewritten}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
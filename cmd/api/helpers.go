@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
@@ -17,14 +22,40 @@ import (
 type envelope map[string]interface{}
 
 func (app *application) readIDParams(r *http.Request) (int64, error) {
+	return app.readIDParam(r, "id")
+}
+
+func (app *application) readIDParam(r *http.Request, name string) (int64, error) {
 	parmas := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(parmas.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(parmas.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
+// readExistingMovieID reads the movie id from the URL and checks that the movie
+// exists, sending the error response itself when it does not.
+func (app *application) readExistingMovieID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0, false
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0, false
+	}
+	return id, true
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 
 	js, err := json.MarshalIndent(data, "", "\t")
@@ -91,6 +122,27 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+// readBody reads the raw request body, subject to the same size limit as
+// readJSON.
+func (app *application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("body must not be larger that %d bytes", maxBytes)
+		}
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+	return body, nil
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -109,6 +161,21 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	return strings.Split(csv, ",")
 }
 
+// readIDs reads a comma separated list of positive integer ids.
+func (app *application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	var ids []int64
+
+	for _, s := range app.readCSV(qs, key, []string{}) {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must be a comma separated list of positive integers")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	s := qs.Get(key)
 
@@ -124,6 +191,195 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readLanguages returns the languages a response should be localised into,
+// most preferred first. The lang query string parameter takes priority over
+// the Accept-Language header, whose quality values are honoured and whose
+// wildcards and malformed tags are skipped.
+func (app *application) readLanguages(r *http.Request, v *validator.Validator) []string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		languages := strings.Split(strings.ToLower(lang), ",")
+		for _, language := range languages {
+			v.Check(validator.Matches(language, data.LocaleRX), "lang", "must be a comma separated list of language tags")
+		}
+		return languages
+	}
+
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var preferences []weighted
+
+	for _, item := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if quality > 0 && data.LocaleRX.MatchString(tag) {
+			preferences = append(preferences, weighted{tag, quality})
+		}
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	languages := make([]string, len(preferences))
+	for i, preference := range preferences {
+		languages[i] = preference.tag
+	}
+	return languages
+}
+
+// setRuntimeFormat has the runtimes of movies written in the format
+// negotiated for the request.
+func (app *application) setRuntimeFormat(r *http.Request, movies ...*data.Movie) {
+	format := app.contextGetRuntimeFormat(r)
+	for _, movie := range movies {
+		movie.RuntimeFormat = format
+	}
+}
+
+// sparseFields narrows the JSON representation of v, which must encode to an
+// object or an array of objects, down to the given fields. When no fields are
+// given v is returned as it is.
+func sparseFields(v interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(js, []byte("null")) {
+		return v, nil
+	}
+
+	pick := func(object map[string]json.RawMessage) map[string]json.RawMessage {
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := object[field]; ok {
+				picked[field] = value
+			}
+		}
+		return picked
+	}
+
+	if len(js) > 0 && js[0] == '[' {
+		var objects []map[string]json.RawMessage
+		if err := json.Unmarshal(js, &objects); err != nil {
+			return nil, err
+		}
+		for i := range objects {
+			objects[i] = pick(objects[i])
+		}
+		return objects, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(js, &object); err != nil {
+		return nil, err
+	}
+	return pick(object), nil
+}
+
+// movieETag identifies a representation of a movie. Every change to a movie
+// bumps its version, but new reviews and adding it to or removing it from a
+// collection do not, so its rating and the collections it is listed in are
+// hashed in as well. A movie which has been localised, narrowed to a sparse
+// fieldset or has its runtime in another format is a different
+// representation, so it gets a weak ETag which also covers the locale, fields
+// and runtime format; If-Match preconditions are only checked against the
+// full movie as it is written by default.
+func movieETag(movie *data.Movie, fields ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s;%+v;", movieRating(movie), movie.Collections)
+
+	if movie.Locale == "" && len(fields) == 0 && movie.RuntimeFormat == "" {
+		return fmt.Sprintf(`"%d-%x"`, movie.Version, h.Sum(nil)[:8])
+	}
+
+	fmt.Fprintf(h, "%s;%s;%s;", movie.Locale, fieldset(fields), movie.RuntimeFormat)
+	return fmt.Sprintf(`W/"%d-%x"`, movie.Version, h.Sum(nil)[:8])
+}
+
+// moviesETag identifies a list of movies by the id, version, locale, runtime
+// format, rating and collections of each movie in it, together with the
+// metadata describing the page and the sparse fieldset the movies were
+// narrowed to.
+func moviesETag(movies []*data.Movie, metadata data.Metadata, fields []string) string {
+	h := sha256.New()
+	for _, movie := range movies {
+		fmt.Fprintf(h, "%d:%d:%s:%s:%s:%+v,", movie.ID, movie.Version, movie.Locale, movie.RuntimeFormat, movieRating(movie), movie.Collections)
+	}
+	fmt.Fprintf(h, "%+v;%s", metadata, fieldset(fields))
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+}
+
+// movieRating formats the rating of a movie for hashing into an ETag.
+func movieRating(movie *data.Movie) string {
+	if movie.AverageRating == nil {
+		return fmt.Sprintf("-/%d", movie.RatingCount)
+	}
+	return fmt.Sprintf("%g/%d", *movie.AverageRating, movie.RatingCount)
+}
+
+// fieldset normalises a sparse fieldset, so that the same fields asked for in
+// a different order or more than once are recognised as the same.
+func fieldset(fields []string) string {
+	normalised := slices.Clone(fields)
+	slices.Sort(normalised)
+	return strings.Join(slices.Compact(normalised), ",")
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header value. If-Match compares strongly, so weak validators in the header
+// never match; If-None-Match compares weakly and ignores the W/ prefix.
+func etagMatches(header, etag string, weak bool) bool {
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func (app *application) background(fn func()) {
 
 	app.wg.Add(1)
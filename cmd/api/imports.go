@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+)
+
+const (
+	maxImportBytes  = 64 << 20
+	importBatchSize = 100
+	// importBatchTimeout is how long each batch of an import has to be read
+	// and saved. The server's ReadTimeout and WriteTimeout would otherwise cut
+	// off imports which take longer than that in total.
+	importBatchTimeout = 30 * time.Second
+)
+
+type importError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+// movieRowFunc is called for every row of an import with its line number and
+// either the decoded movie or the reason the row could not be read.
+type movieRowFunc func(line int, movie *data.Movie, err error) error
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	mode := app.readString(qs, "mode", "atomic")
+	v.Check(validator.In(mode, "atomic", "best_effort"), "mode", "must be either atomic or best_effort")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var readRows func(io.Reader, movieRowFunc) error
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		readRows = readNDJSONMovies
+	case "text/csv":
+		readRows = readCSVMovies
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/x-ndjson", "text/csv")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	rc := http.NewResponseController(w)
+	extendDeadlines := func() error {
+		deadline := time.Now().Add(importBatchTimeout)
+		if err := rc.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		return rc.SetWriteDeadline(deadline)
+	}
+
+	err := extendDeadlines()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	catalogue, err := app.models.Genres.Catalogue()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	imp, err := app.models.Movies.NewImport(mode == "atomic", app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer imp.Rollback()
+
+	created := []int64{}
+	rowErrors := []importError{}
+	batch := make([]*data.Movie, 0, importBatchSize)
+	read := 0
+
+	flush := func() error {
+		err := imp.Insert(batch)
+		if err != nil {
+			return err
+		}
+		for _, movie := range batch {
+			created = append(created, movie.ID)
+		}
+		batch = batch[:0]
+		return extendDeadlines()
+	}
+
+	err = readRows(r.Body, func(line int, movie *data.Movie, err error) error {
+		// Rows which are rejected never fill a batch, so the deadlines are
+		// extended as rows are read as well as when batches are saved.
+		read++
+		if read%importBatchSize == 0 {
+			if err := extendDeadlines(); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			rowErrors = append(rowErrors, importError{Line: line, Errors: map[string]string{"row": err.Error()}})
+			return nil
+		}
+
+		v := validator.New()
+		movie.Genres = catalogue.Normalise(v, "genres", movie.Genres)
+		if data.ValidateMovie(v, movie); !v.Valid() {
+			rowErrors = append(rowErrors, importError{Line: line, Errors: v.Errors})
+			return nil
+		}
+
+		batch = append(batch, movie)
+		if len(batch) == importBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		status, message := http.StatusBadRequest, err.Error()
+
+		var maxBytesError *http.MaxBytesError
+		var parseError *csv.ParseError
+		switch {
+		case errors.As(err, &maxBytesError):
+			message = fmt.Sprintf("body must not be larger than %d bytes", maxImportBytes)
+		case errors.Is(err, bufio.ErrTooLong):
+			message = "body contains a line longer than 1048576 bytes"
+		case errors.As(err, &parseError), errors.Is(err, errInvalidCSVHeader):
+		default:
+			app.logError(r, err)
+			status, message = http.StatusInternalServerError, "the server encountered a problem and could not process your request"
+		}
+
+		// The batches saved before a best effort import failed are kept, so
+		// the client is told which movies were created along with the error.
+		if mode == "best_effort" {
+			err = app.writeJSON(w, status, envelope{"error": message, "created": created, "errors": rowErrors}, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.errorResonse(w, r, status, message)
+		return
+	}
+
+	if mode == "atomic" && len(rowErrors) > 0 {
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"created": []int64{}, "errors": rowErrors}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = imp.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if len(created) == 0 && len(rowErrors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeJSON(w, status, envelope{"created": created, "errors": rowErrors}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type movieImportRow struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+}
+
+func readNDJSONMovies(r io.Reader, fn movieRowFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var row movieImportRow
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&row)
+		if err != nil {
+			err = fn(line, nil, fmt.Errorf("contains invalid JSON: %w", err))
+		} else {
+			err = fn(line, &data.Movie{Title: row.Title, Year: row.Year, Runtime: row.Runtime, Genres: row.Genres}, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+var errInvalidCSVHeader = errors.New("csv header must be title,year,runtime,genres")
+
+// readCSVMovies reads rows with a title,year,runtime,genres header. Genres are
+// separated by "|" and the runtime may be written in any of the forms the
+// JSON API accepts.
+func readCSVMovies(r io.Reader, fn movieRowFunc) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errInvalidCSVHeader
+		}
+		return err
+	}
+	if strings.Join(header, ",") != "title,year,runtime,genres" {
+		return errInvalidCSVHeader
+	}
+
+	for {
+		record, err := reader.Read()
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.Is(err, csv.ErrFieldCount):
+			line, _ := reader.FieldPos(0)
+			err = fn(line, nil, errors.New("must have exactly 4 fields"))
+			if err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		movie, err := parseCSVMovie(record)
+		err = fn(line, movie, err)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func parseCSVMovie(record []string) (*data.Movie, error) {
+	year, err := strconv.ParseInt(record[1], 10, 32)
+	if err != nil {
+		return nil, errors.New("year must be an integer value")
+	}
+
+	var runtime data.Runtime
+	err = runtime.UnmarshalJSON([]byte(strconv.Quote(record[2])))
+	if err != nil {
+		return nil, fmt.Errorf("runtime: %w", err)
+	}
+
+	var genres []string
+	if record[3] != "" {
+		genres = strings.Split(record[3], "|")
+	}
+
+	return &data.Movie{Title: record[0], Year: int32(year), Runtime: runtime, Genres: genres}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// runPeriodically calls fn straight away and then every interval until the
+// server shuts down, which waits for a run in progress to finish. Errors and
+// panics are logged and do not stop the later runs.
+func (app *application) runPeriodically(name string, interval time.Duration, fn func() error) {
+	run := func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+			}
+		}()
+
+		if err := fn(); err != nil {
+			app.logger.PrintError(err, map[string]string{"job": name})
+		}
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			run()
+
+			select {
+			case <-ticker.C:
+			case <-app.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (app *application) purgeDeletedMovies() error {
+	purged, posters, err := app.models.Movies.PurgeDeleted(app.config.trash.retention)
+	if err != nil {
+		return err
+	}
+
+	for _, poster := range posters {
+		err := app.posters.Delete(path.Dir(string(poster)))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"job": "purge_deleted_movies", "poster": string(poster)})
+		}
+	}
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged deleted movies", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+	return nil
+}
+
+func (app *application) refreshMovieStats() error {
+	return app.models.Movies.RefreshStats()
+}
+
+func (app *application) purgeIdempotencyKeys() error {
+	purged, err := app.models.IdempotencyKeys.DeleteExpired()
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged expired idempotency keys", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/jsonlog"
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/mailer"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/storage"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -29,6 +30,7 @@ type config struct {
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		searchConfig string
 	}
 	limiter struct {
 		rps     float64
@@ -45,14 +47,30 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	trash struct {
+		retention time.Duration
+	}
+	posters struct {
+		dir string
+	}
+	stats struct {
+		refreshInterval time.Duration
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *jsonlog.Logger
+	models  data.Models
+	mailer  mailer.Mailer
+	posters storage.Storage
+	wg      sync.WaitGroup
+	// stop is closed when the server shuts down, to stop the jobs started
+	// by runPeriodically.
+	stop chan struct{}
 }
 
 func main() {
@@ -75,6 +93,7 @@ func main() {
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	flag.StringVar(&cfg.db.searchConfig, "db-search-config", "movies_search", "PostgreSQL text search configuration for movie titles")
 
 	// rate limiter flages
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
@@ -94,6 +113,14 @@ func main() {
 		return nil
 	})
 
+	flag.StringVar(&cfg.posters.dir, "posters-dir", "./uploads/posters", "Directory poster images are stored in")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before being purged")
+
+	flag.DurationVar(&cfg.stats.refreshInterval, "stats-refresh-interval", 15*time.Minute, "How often the catalogue statistics are recomputed")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses are replayed to requests retried with the same Idempotency-Key")
+
 	flag.Parse()
 
 	if cfg.db.dsn == "" {
@@ -124,13 +151,22 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	models := data.NewModels(db)
+	models.Movies.SearchConfig = cfg.db.searchConfig
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:  cfg,
+		logger:  logger,
+		models:  models,
+		mailer:  mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		posters: storage.Local{Root: cfg.posters.dir},
+		stop:    make(chan struct{}),
 	}
 
+	app.runPeriodically("purge_deleted_movies", time.Hour, app.purgeDeletedMovies)
+	app.runPeriodically("refresh_movie_stats", cfg.stats.refreshInterval, app.refreshMovieStats)
+	app.runPeriodically("purge_idempotency_keys", time.Hour, app.purgeIdempotencyKeys)
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
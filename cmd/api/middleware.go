@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"expvar"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -182,7 +187,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
 
 						w.WriteHeader(http.StatusOK)
 						return
@@ -206,7 +211,9 @@ func (app *application) metrices(next http.Handler) http.Handler {
 
 		totalRequestRecived.Add(1)
 
-		metrics := httpsnoop.CaptureMetrics(next, w, r)
+		metrics := httpsnoop.CaptureMetricsFn(w, func(snooped http.ResponseWriter) {
+			next.ServeHTTP(&metricsWriter{ResponseWriter: snooped, unwrapped: w}, r)
+		})
 
 		// next.ServeHTTP(w,r)
 
@@ -217,3 +224,243 @@ func (app *application) metrices(next http.Handler) http.Handler {
 
 	})
 }
+
+// metricsWriter lets an http.ResponseController reach past the writer
+// httpsnoop wraps responses in, which does not implement Unwrap itself.
+type metricsWriter struct {
+	http.ResponseWriter
+	unwrapped http.ResponseWriter
+}
+
+func (w *metricsWriter) Unwrap() http.ResponseWriter {
+	return w.unwrapped
+}
+
+func (w *metricsWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// negotiateRuntimeFormat picks how runtimes are written in JSON responses,
+// from the runtime_format query string parameter or else from a profile such
+// as "runtime-iso8601" on the application/json media range of the Accept
+// header. Requests asking for neither get the default "<n> mins" form.
+func (app *application) negotiateRuntimeFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		format := r.URL.Query().Get("runtime_format")
+		if format != "" {
+			v := validator.New()
+			if v.Check(validator.In(format, data.RuntimeFormats...), "runtime_format", "must be one of mins, minutes or iso8601"); !v.Valid() {
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+		} else {
+			format = acceptedRuntimeFormat(r.Header.Get("Accept"))
+		}
+
+		if format != "" && data.RuntimeFormat(format) != data.RuntimeMins {
+			r = app.contextSetRuntimeFormat(r, data.RuntimeFormat(format))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptedRuntimeFormat returns the runtime format named by a profile in an
+// Accept header, or an empty string if there is none.
+func acceptedRuntimeFormat(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil || (mediaType != "application/json" && mediaType != "*/*") {
+			continue
+		}
+
+		for _, profile := range strings.Fields(params["profile"]) {
+			format, ok := strings.CutPrefix(profile, "runtime-")
+			if ok && validator.In(format, data.RuntimeFormats...) {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxStoredResponseBytes caps the size of the responses kept against an
+	// idempotency key. Larger responses are not stored.
+	maxStoredResponseBytes = 1 << 20
+)
+
+// idempotencyRecorder keeps a copy of a response as it is written, so it can
+// be stored against an idempotency key.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	// before holds the headers set before the handler ran, which belong to
+	// this request rather than to the response being recorded.
+	before http.Header
+	// request is the request body as read through the hash fingerprinting
+	// the request. Whatever the handler leaves unread is drained through it
+	// before the response starts, as the server may discard it after that.
+	request    io.Reader
+	requestErr error
+	status     int
+	header     http.Header
+	body       bytes.Buffer
+	overflow   bool
+}
+
+func (w *idempotencyRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+
+		_, w.requestErr = io.Copy(io.Discard, w.request)
+
+		w.header = make(http.Header)
+		for name, values := range w.Header() {
+			if !slices.Equal(values, w.before[name]) {
+				w.header[name] = slices.Clone(values)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.body.Len()+len(b) > maxStoredResponseBytes {
+		w.overflow = true
+	} else {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *idempotencyRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// storable reports whether the recorded response should be replayed to
+// retries. It must have been answered to a request which could be read in
+// full, so its fingerprint is known. Server errors are not stored, so the
+// request can be retried with the same key, and neither are responses which
+// must not be stored, such as those carrying credentials.
+func (w *idempotencyRecorder) storable() bool {
+	return w.status != 0 && w.requestErr == nil && w.status < http.StatusInternalServerError && !w.overflow &&
+		!strings.Contains(w.Header().Get("Cache-Control"), "no-store")
+}
+
+// idempotent lets clients retry POST requests safely by sending an
+// Idempotency-Key header. The first response to a request with a key is
+// stored for the user who sent it, or for the client address if they have
+// not authenticated, until the key expires, and retries with
+// the same key and body are answered with it instead of being handled again.
+// A key reused for a different request is rejected. Requests are told apart
+// by a hash of their body, which is computed as the body is read rather than
+// by holding it in memory.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+		if v.Check(len(key) <= maxIdempotencyKeyLength, "Idempotency-Key", fmt.Sprintf("must not be more than %d bytes long", maxIdempotencyKeyLength)); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+
+		// No POST route accepts a larger body than an import.
+		body := io.TeeReader(http.MaxBytesReader(w, r.Body, maxImportBytes), h)
+
+		scoped := data.IdempotencyKey{UserID: app.contextGetUser(r).ID, Key: key}
+		if app.contextGetUser(r).IsAnonymous() {
+			scoped.Client = realip.FromRequest(r)
+		}
+
+		stored, err := app.models.IdempotencyKeys.Claim(scoped, time.Now().Add(app.config.idempotency.ttl))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyInUse):
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if stored != nil {
+			_, err := io.Copy(io.Discard, body)
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				switch {
+				case errors.As(err, &maxBytesError):
+					app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxImportBytes))
+				default:
+					app.badRequestResponse(w, r, err)
+				}
+				return
+			}
+
+			if !bytes.Equal(h.Sum(nil), stored.RequestHash) {
+				app.idempotencyKeyMismatchResponse(w, r)
+				return
+			}
+
+			for name, values := range stored.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		r.Body = io.NopCloser(body)
+		recorder := &idempotencyRecorder{ResponseWriter: w, before: w.Header().Clone(), request: body}
+
+		// The key is released unless a response is saved, including when the
+		// handler panics.
+		saved := false
+		defer func() {
+			if !saved {
+				if err := app.models.IdempotencyKeys.Release(scoped); err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.storable() {
+			err = app.models.IdempotencyKeys.Save(scoped, &data.StoredResponse{
+				RequestHash: h.Sum(nil),
+				Status:      recorder.status,
+				Header:      recorder.header,
+				Body:        recorder.body.Bytes(),
+			})
+			if err != nil {
+				app.logError(r, err)
+				return
+			}
+			saved = true
+		}
+	})
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/jsonpatch"
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
 )
 
@@ -32,19 +35,39 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 	v := validator.New()
 
+	force := app.readBool(r.URL.Query(), "force", false, v)
+
+	err = app.normaliseGenres(v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	if force {
+		err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
+	} else {
+		var existingID int64
+		existingID, err = app.models.Movies.InsertUnique(movie, app.contextGetUser(r).ID)
+		if errors.Is(err, data.ErrDuplicateMovie) {
+			app.duplicateMovieResponse(w, r, existingID)
+			return
+		}
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.setRuntimeFormat(r, movie)
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
@@ -64,7 +87,26 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 	}
 	// app.logger.Printf("Fetching movie with ID: %d\n", id)
 
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	fields := app.readCSV(qs, "fields", []string{})
+	data.ValidateMovieFields(v, fields)
+
+	embed := app.readCSV(qs, "embed", []string{})
+	for _, name := range embed {
+		v.Check(validator.In(name, "credits"), "embed", fmt.Sprintf("unknown embed %q", name))
+	}
+
+	languages := app.readLanguages(r, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetFields(id, fields)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -75,9 +117,52 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if validator.In("credits", embed...) {
+		movie.Credits, err = app.models.Credits.GetAllForMovie(movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(fields) > 0 {
+			fields = append(fields, "credits")
+		}
+	}
+
+	err = app.models.Translations.Localise([]*data.Movie{movie}, languages)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.setRuntimeFormat(r, movie)
+
 	// app.logger.Println("Movie fetched successfully. Sending response.")
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	w.Header().Add("Vary", "Accept-Language")
+
+	// Credits are not covered by the movie version, so a response embedding
+	// them cannot be validated by its ETag.
+	headers := make(http.Header)
+	if movie.Locale != "" {
+		headers.Set("Content-Language", movie.Locale)
+	}
+	if movie.Credits == nil {
+		etag := movieETag(movie, fields...)
+		if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		headers.Set("ETag", etag)
+	}
+
+	body, err := sparseFields(movie, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": body}, headers)
 	if err != nil {
 		// app.logger.Println("Error writing JSON response:", err)
 		app.serverErrorResponse(w, r, err)
@@ -85,26 +170,67 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 
 }
 
+// readMovieFilters reads and validates the query string parameters that
+// narrow down which movies are listed.
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	var filters data.MovieFilters
+
+	filters.Title = app.readString(qs, "title", "")
+
+	filters.Genres = app.readCSV(qs, "genres", []string{})
+	filters.GenresMode = app.readString(qs, "genres_mode", "all")
+	filters.ExcludeGenres = app.readCSV(qs, "exclude_genres", []string{})
+
+	filters.YearMin = app.readInt(qs, "year_min", 0, v)
+	filters.YearMax = app.readInt(qs, "year_max", 0, v)
+	filters.RuntimeMin = app.readInt(qs, "runtime_min", 0, v)
+	filters.RuntimeMax = app.readInt(qs, "runtime_max", 0, v)
+
+	filters.PersonID = int64(app.readInt(qs, "person_id", 0, v))
+
+	data.ValidateMovieFilters(v, filters)
+
+	return filters
+}
+
 func (app *application) ListMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("ids") {
+		app.batchGetMoviesHandler(w, r)
+		return
+	}
 
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilters
 		data.Filters
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
+	input.MovieFilters = app.readMovieFilters(qs, v)
 
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	err := app.normaliseGenreFilters(v, &input.MovieFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.Highlight = app.readBool(qs, "highlight", false, v)
+
+	input.Fields = app.readCSV(qs, "fields", []string{})
+	data.ValidateMovieFields(v, input.Fields)
+
+	input.Facets = app.readCSV(qs, "facets", []string{})
+	data.ValidateMovieFacets(v, input.Facets)
+
+	languages := app.readLanguages(r, v)
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "rating", "relevance", "-id", "-title", "-year", "-runtime", "-rating"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -112,13 +238,154 @@ func (app *application) ListMoviesHandler(w http.ResponseWriter, r *http.Request
 	}
 	// fmt.Fprintf(w, "%+v\n", input)
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilters, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	err = app.models.Translations.Localise(movies, languages)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.setRuntimeFormat(r, movies...)
+
+	w.Header().Add("Vary", "Accept-Language")
+
+	etag := moviesETag(movies, metadata, input.Fields)
+	if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	body, err := sparseFields(movies, input.Fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": body, "metadata": metadata}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxBatchIDs caps the number of movies which can be fetched at once by id.
+const maxBatchIDs = 100
+
+// batchGetMoviesHandler fetches the movies listed in the ids parameter, in the
+// order they were asked for. Ids with no movie behind them, including those of
+// movies in the trash, are listed under missing rather than failing the
+// request.
+func (app *application) batchGetMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	ids := app.readIDs(qs, "ids", v)
+	v.Check(len(ids) > 0, "ids", "must be provided")
+	v.Check(len(ids) <= maxBatchIDs, "ids", fmt.Sprintf("must not contain more than %d ids", maxBatchIDs))
 
+	fields := app.readCSV(qs, "fields", []string{})
+	data.ValidateMovieFields(v, fields)
+
+	languages := app.readLanguages(r, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Repeated ids are only returned once, at their first position.
+	requested := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !requested[id] {
+			requested[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	movies, err := app.models.Movies.GetByIDs(unique, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	found := make(map[int64]bool, len(movies))
+	for _, movie := range movies {
+		found[movie.ID] = true
+	}
+
+	missing := []int64{}
+	for _, id := range unique {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	err = app.models.Translations.Localise(movies, languages)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.setRuntimeFormat(r, movies...)
+
+	w.Header().Add("Vary", "Accept-Language")
+
+	etag := moviesETag(movies, data.Metadata{}, fields)
+	if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	body, err := sparseFields(movies, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": body, "missing": missing}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Movies.Suggest(q, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -145,41 +412,269 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, movieETag(movie), false) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "", "application/json":
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+
+	case "application/json-patch+json", "application/merge-patch+json":
+		err = app.patchMovie(w, r, movie, mediaType)
+		if err != nil {
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.patchTestFailedResponse(w, r, err)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/json", "application/json-patch+json", "application/merge-patch+json")
+		return
+	}
+
+	v := validator.New()
+
+	err = app.normaliseGenres(v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflit) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflit):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.setRuntimeFormat(r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+func (app *application) DeleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// With If-Match the delete only goes ahead while the movie is still at the
+	// version the client last saw.
+	var version int32
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !etagMatches(ifMatch, movieETag(movie), false) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound) && version != 0:
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie sucessfully moved to the trash"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+		data.Filters
 	}
 
-	err = app.readJSON(w, r, &input)
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetDeleted(input.Filters)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	app.setRuntimeFormat(r, movies...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
+}
 
-	if input.Year != nil {
-		movie.Year = *input.Year
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+
+	app.setRuntimeFormat(r, movie)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+}
+
+// mergeMovieHandler folds the movie in the URL, a duplicate, into the movie
+// given by "into" and moves it to the trash.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	source, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Into int64 `json:"into"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	v.Check(input.Into > 0, "into", "must be provided")
+	v.Check(input.Into != source.ID, "into", "must be a different movie")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	target, err := app.models.Movies.Get(input.Into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "no such movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, genre := range source.Genres {
+		if !validator.In(genre, target.Genres...) {
+			target.Genres = append(target.Genres, genre)
+		}
+	}
+
+	if data.ValidateMovie(v, target); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Merge(source, target, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflit):
@@ -190,22 +685,45 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	app.setRuntimeFormat(r, target)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(target))
 
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": target}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-
 }
 
-func (app *application) DeleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) similarMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParams(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = "similarity"
+	input.Filters.SortSafelist = []string{"similarity"}
+
+	languages := app.readLanguages(r, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -216,7 +734,53 @@ func (app *application) DeleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie sucessfully deleted"}, nil)
+	movies, metadata, err := app.models.Movies.GetSimilar(movie, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Translations.Localise(movies, languages)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+
+	app.setRuntimeFormat(r, movies...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	criteria := app.readMovieFilters(r.URL.Query(), v)
+
+	err := app.normaliseGenreFilters(v, &criteria)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, err := app.models.Movies.Stats(criteria)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	stats.Runtime.Format = app.contextGetRuntimeFormat(r)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
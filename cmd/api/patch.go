@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/jsonpatch"
+)
+
+// moviePatchDocument is the representation of a movie that JSON Patch and
+// JSON Merge Patch documents are applied to. The id and version are there so
+// that patches can test them, but they cannot be changed.
+type moviePatchDocument struct {
+	ID      int64        `json:"id"`
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+	Version int32        `json:"version"`
+}
+
+// patchMovie applies the JSON Patch or JSON Merge Patch in the request body to
+// movie, according to mediaType.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie, mediaType string) error {
+	patch, err := app.readBody(w, r)
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(moviePatchDocument{
+		ID:      movie.ID,
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+		Version: movie.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	if mediaType == "application/json-patch+json" {
+		doc, err = jsonpatch.Apply(doc, patch)
+	} else {
+		doc, err = jsonpatch.Merge(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	var patched moviePatchDocument
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&patched)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError):
+			return fmt.Errorf("patched movie contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			return fmt.Errorf("patched movie contains unknown key %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return fmt.Errorf("patched movie is invalid: %w", err)
+		}
+	}
+
+	if patched.ID != movie.ID {
+		return errors.New("id cannot be changed")
+	}
+	if patched.Version != movie.Version {
+		return errors.New("version cannot be changed")
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return nil
+}
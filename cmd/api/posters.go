@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/data"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/storage"
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	maxPosterBytes     = 10 << 20
+	maxPosterDimension = 4000
+	minPosterDimension = 100
+)
+
+func (app *application) uploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		app.unsupportedMediaTypeResponse(w, r, "multipart/form-data")
+		return
+	}
+
+	body, err := readPosterPart(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(body))
+
+	v.Check(err == nil && (format == "jpeg" || format == "png"), "poster", "must be a JPEG or PNG image")
+	if v.Valid() {
+		v.Check(config.Width <= maxPosterDimension && config.Height <= maxPosterDimension, "poster", fmt.Sprintf("must not be larger than %dx%d pixels", maxPosterDimension, maxPosterDimension))
+		v.Check(config.Width >= minPosterDimension && config.Height >= minPosterDimension, "poster", fmt.Sprintf("must be at least %dx%d pixels", minPosterDimension, minPosterDimension))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		v.AddError("poster", "must be a JPEG or PNG image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The key includes a hash of the image, so a new upload always gets new
+	// URLs and the files behind them can be cached forever.
+	sum := sha256.Sum256(body)
+	dir := fmt.Sprintf("%d/%x", movie.ID, sum[:8])
+	extension := map[string]string{"jpeg": "jpg", "png": "png"}[format]
+	poster := data.Poster(path.Join(dir, "original."+extension))
+
+	// Re-uploading the current image writes into the live poster's directory,
+	// which must survive a failed upload.
+	cleanup := func() {
+		if path.Dir(string(movie.Poster)) != dir {
+			app.posters.Delete(dir)
+		}
+	}
+
+	err = app.storePoster(poster, body, img)
+	if err != nil {
+		cleanup()
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	replaced, err := app.models.Movies.SetPoster(movie, poster, app.contextGetUser(r).ID)
+	if err != nil {
+		cleanup()
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if replaced != "" && path.Dir(string(replaced)) != dir {
+		err = app.posters.Delete(path.Dir(string(replaced)))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"poster": string(replaced)})
+		}
+	}
+
+	app.setRuntimeFormat(r, movie)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readPosterPart returns the contents of the "poster" part of a multipart
+// request body.
+func readPosterPart(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPosterBytes+1<<20)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.Is(err, io.EOF):
+				return nil, errors.New("body must contain a poster part")
+			case errors.As(err, &maxBytesError):
+				return nil, fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+			default:
+				return nil, err
+			}
+		}
+
+		if part.FormName() != "poster" {
+			part.Close()
+			continue
+		}
+
+		body, err := io.ReadAll(io.LimitReader(part, maxPosterBytes+1))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return nil, fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+			}
+			return nil, err
+		}
+		if len(body) > maxPosterBytes {
+			return nil, fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+		}
+		return body, nil
+	}
+}
+
+// storePoster saves the original upload along with a JPEG thumbnail for each
+// of data.PosterSizes.
+func (app *application) storePoster(poster data.Poster, original []byte, img image.Image) error {
+	err := app.posters.Put(string(poster), bytes.NewReader(original))
+	if err != nil {
+		return err
+	}
+
+	flat := flatten(img)
+
+	for name, width := range data.PosterSizes {
+		var buf bytes.Buffer
+
+		err := jpeg.Encode(&buf, resize(flat, width), &jpeg.Options{Quality: 85})
+		if err != nil {
+			return err
+		}
+
+		err = app.posters.Put(poster.Thumbnail(name), &buf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flatten draws img onto a white background, since JPEG thumbnails have no
+// transparency.
+func flatten(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+	return flat
+}
+
+// resize scales src down to the given width, keeping its aspect ratio, by
+// averaging the block of source pixels behind each destination pixel. Images
+// which are already narrow enough are returned as they are.
+func resize(src *image.RGBA, width int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= width {
+		return src
+	}
+
+	height := max(1, sh*width/sw)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := max((y+1)*sh/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := max((x+1)*sw/width, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[i+c])
+					}
+					i += 4
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+func (app *application) servePosterHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("key"), "/")
+
+	f, modified, err := app.posters.Open(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	// Poster keys contain a hash of the image, so a key always refers to the
+	// same content.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	http.ServeContent(w, r, path.Base(key), modified, f)
+}
@@ -43,6 +43,7 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(app.stop)
 		app.wg.Wait()
 		shutdownError <- nil
 
@@ -59,7 +59,12 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	// The token must not be kept by caches, nor stored to be replayed to
+	// requests retried with the same idempotency key.
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
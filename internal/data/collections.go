@@ -0,0 +1,430 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUnknownMovie            = errors.New("unknown movie")
+	ErrDuplicateCollectionItem = errors.New("duplicate collection item")
+)
+
+// movieCollectionsColumn reads the collections a movie belongs to as a JSON
+// array of CollectionSummary. It is listed by movieColumns like any other
+// column and needs the movies table in scope under its own name.
+const movieCollectionsColumn = `COALESCE((
+				SELECT json_agg(json_build_object('id', collections.id, 'name', collections.name) ORDER BY collections.name, collections.id)
+				FROM collection_items
+				INNER JOIN collections ON collections.id = collection_items.collection_id
+				WHERE collection_items.movie_id = movies.id), '[]')`
+
+// jsonColumn scans a json column into the value dest points to.
+type jsonColumn struct {
+	dest interface{}
+}
+
+func (c jsonColumn) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, c.dest)
+	case string:
+		return json.Unmarshal([]byte(src), c.dest)
+	default:
+		return fmt.Errorf("cannot scan %T into json", src)
+	}
+}
+
+// CollectionSummary names a collection a movie belongs to.
+type CollectionSummary struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	// MovieCount and Movies leave out movies which are in the trash.
+	MovieCount int64    `json:"movie_count"`
+	Version    int32    `json:"version"`
+	Movies     []*Movie `json:"movies,omitempty"`
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(collection.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+// ValidateCollectionOrder checks that movieIDs lists every movie of the
+// collection exactly once.
+func ValidateCollectionOrder(v *validator.Validator, collection *Collection, movieIDs []int64) {
+	v.Check(movieIDs != nil, "movies", "must be provided")
+
+	listed := make(map[int64]bool, len(movieIDs))
+	for _, id := range movieIDs {
+		listed[id] = true
+	}
+
+	complete := len(listed) == len(movieIDs) && len(movieIDs) == len(collection.Movies)
+	for _, movie := range collection.Movies {
+		complete = complete && listed[movie.ID]
+	}
+	v.Check(complete, "movies", "must list every movie in the collection exactly once")
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `
+			INSERT INTO collections (name, description)
+			VALUES ($1, $2)
+			RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, collection.Name, collection.Description).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+}
+
+// Get fetches a collection along with its movies, in order.
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT id, created_at, name, description, version
+			FROM collections
+			WHERE id = $1`
+
+	var collection Collection
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		&collection.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	columns := movieColumns(nil)
+
+	query = `
+			SELECT ` + strings.Join(columns, ", ") + `
+			FROM movies
+			INNER JOIN collection_items ON collection_items.movie_id = movies.id
+			WHERE collection_items.collection_id = $1 AND movies.deleted_at IS NULL
+			ORDER BY collection_items.position ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collection.Movies = []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(movie.scanDest(columns)...)
+		if err != nil {
+			return nil, err
+		}
+		collection.Movies = append(collection.Movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	collection.MovieCount = int64(len(collection.Movies))
+	return &collection, nil
+}
+
+// GetAll lists collections without their movies.
+func (m CollectionModel) GetAll(name string, filters Filters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), id, created_at, name, description, version,
+				(SELECT count(*) FROM collection_items
+					INNER JOIN movies ON movies.id = collection_items.movie_id
+					WHERE collection_items.collection_id = collections.id AND movies.deleted_at IS NULL)
+			FROM collections
+			WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+			ORDER BY %s %s, id ASC
+			LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(
+			&totalRecords,
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.Version,
+			&collection.MovieCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m CollectionModel) Update(collection *Collection) error {
+	query := `
+			UPDATE collections SET name = $1, description = $2, version = version + 1
+			WHERE id = $3 AND version = $4
+			RETURNING version`
+
+	args := []interface{}{collection.Name, collection.Description, collection.ID, collection.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflit
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a collection. The movies in it are left alone.
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM collections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// bumpVersion takes a new version of a collection within tx, which also locks
+// it against concurrent changes to its items until tx ends. A non-zero
+// version restricts the change to that version of the collection.
+func (m CollectionModel) bumpVersion(ctx context.Context, tx *sql.Tx, collection *Collection, version int32) error {
+	query := `
+			UPDATE collections SET version = version + 1
+			WHERE id = $1 AND (version = $2 OR $2 = 0)
+			RETURNING version`
+
+	err := tx.QueryRowContext(ctx, query, collection.ID, version).Scan(&collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflit
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// AddMovie puts a movie into a collection at the given 1-based position among
+// the movies listed in it, moving those from that position onwards down one
+// place. A position of 0, or one past the end of the list, adds the movie at
+// the end.
+func (m CollectionModel) AddMovie(collection *Collection, movieID int64, position int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.bumpVersion(ctx, tx, collection, 0)
+	if err != nil {
+		return err
+	}
+
+	// Movies in the trash keep their place, so the position asked for is
+	// translated into the position of the listed movie currently there.
+	query := `SELECT COALESCE(max(position), 0) + 1 FROM collection_items WHERE collection_id = $1`
+	args := []interface{}{collection.ID}
+	if position > 0 {
+		query = `
+				SELECT COALESCE((
+					SELECT collection_items.position
+					FROM collection_items
+					INNER JOIN movies ON movies.id = collection_items.movie_id
+					WHERE collection_items.collection_id = $1 AND movies.deleted_at IS NULL
+					ORDER BY collection_items.position ASC
+					OFFSET $2 LIMIT 1
+				), (` + query + `))`
+		args = append(args, position-1)
+	}
+
+	var at int
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&at)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE collection_items SET position = position + 1 WHERE collection_id = $1 AND position >= $2`, collection.ID, at)
+	if err != nil {
+		return err
+	}
+
+	query = `
+			INSERT INTO collection_items (collection_id, movie_id, position)
+			SELECT $1, id, $3 FROM movies WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, collection.ID, movieID, at)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collection_items_pkey"`:
+			return ErrDuplicateCollectionItem
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUnknownMovie
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMovie takes a movie out of a collection, closing the gap it leaves.
+func (m CollectionModel) RemoveMovie(collection *Collection, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.bumpVersion(ctx, tx, collection, 0)
+	if err != nil {
+		return err
+	}
+
+	var position int
+	err = tx.QueryRowContext(ctx, `DELETE FROM collection_items WHERE collection_id = $1 AND movie_id = $2 RETURNING position`, collection.ID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE collection_items SET position = position - 1 WHERE collection_id = $1 AND position > $2`, collection.ID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder puts the movies of a collection into the order of movieIDs, which
+// should have been checked with ValidateCollectionOrder against the same
+// version of the collection. Movies in the trash keep their place, as they
+// do when a movie is added, and the listed movies are rearranged around them.
+func (m CollectionModel) Reorder(collection *Collection, movieIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.bumpVersion(ctx, tx, collection, collection.Version)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			WITH slots AS (
+				SELECT position, row_number() OVER (ORDER BY position ASC) AS n
+				FROM collection_items
+				WHERE collection_id = $1 AND movie_id = ANY($2)
+			), ordered AS (
+				SELECT listed.movie_id, slots.position
+				FROM unnest($2::bigint[]) WITH ORDINALITY AS listed(movie_id, n)
+				INNER JOIN slots ON slots.n = listed.n
+			)
+			UPDATE collection_items SET position = ordered.position
+			FROM ordered
+			WHERE collection_items.collection_id = $1 AND collection_items.movie_id = ordered.movie_id`
+
+	_, err = tx.ExecContext(ctx, query, collection.ID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -1,6 +1,9 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"math"
 	"strings"
 
@@ -12,6 +15,39 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks a position in a sorted result set by the value of the sort
+// column and the id of the row it was taken from. Backward cursors point at
+// the first row of a page and ask for the rows that come before it.
+type cursor struct {
+	Sort     string `json:"s"`
+	Value    string `json:"v"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -23,6 +59,12 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "must be a cursor returned by a previous request")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "was issued for a different sort value")
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -41,6 +83,22 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+func reverseDirection(direction string) string {
+	if direction == "DESC" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// keysetDirection returns the comparison operator that selects rows after
+// the cursor for the current sort, or before it for a backward cursor.
+func (f Filters) keysetDirection(backward bool) string {
+	if (f.sortDirection() == "DESC") != backward {
+		return "<"
+	}
+	return ">"
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -50,11 +108,20 @@ func (f Filters) offset() int {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+	// Facets holds the bucket counts asked for with MovieFilters.Facets.
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+}
+
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
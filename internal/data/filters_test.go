@@ -0,0 +1,95 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{name: "ascending", cursor: cursor{Sort: "id", Value: "42", ID: 42}},
+		{name: "descending", cursor: cursor{Sort: "-year", Value: "1995", ID: 7}},
+		{name: "backward", cursor: cursor{Sort: "title", Value: "Heat", ID: 3, Backward: true}},
+		{name: "empty value", cursor: cursor{Sort: "title", Value: "", ID: 1}},
+		{name: "unicode value", cursor: cursor{Sort: "title", Value: "Amélie / \"Le fabuleux destin\"", ID: 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(tt.cursor)
+
+			got, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decoding %q: unexpected error: %v", encoded, err)
+			}
+			if got != tt.cursor {
+				t.Errorf("got %+v; want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	valid := encodeCursor(cursor{Sort: "id", Value: "42", ID: 42})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"s":"id","v":"1","id":1}`))},
+		{name: "truncated", cursor: valid[:len(valid)-3]},
+		{name: "not JSON", cursor: base64.RawURLEncoding.EncodeToString([]byte("id=42"))},
+		{name: "wrong types", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":42,"id":"42"}`))},
+		{name: "missing id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"42"}`))},
+		{name: "zero id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"42","id":0}`))},
+		{name: "negative id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"42","id":-1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got %+v, %v; want ErrInvalidCursor", got, err)
+			}
+		})
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		valid  bool
+	}{
+		{name: "no cursor", sort: "id", valid: true},
+		{name: "cursor for sort", sort: "-year", cursor: encodeCursor(cursor{Sort: "-year", Value: "1995", ID: 7}), valid: true},
+		{name: "cursor for other sort", sort: "year", cursor: encodeCursor(cursor{Sort: "-year", Value: "1995", ID: 7})},
+		{name: "tampered cursor", sort: "id", cursor: "tampered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateFilters(v, Filters{
+				Page:         1,
+				PageSize:     20,
+				Sort:         tt.sort,
+				SortSafelist: []string{"id", "year", "-id", "-year"},
+				Cursor:       tt.cursor,
+			})
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid to be %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateGenre = errors.New("duplicate genre")
+
+type Genre struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Slug       string   `json:"slug"`
+	Aliases    []string `json:"aliases"`
+	MovieCount int64    `json:"movie_count"`
+}
+
+// GenreSlug reduces a genre name to its lower case letters and digits, with
+// every other run of characters replaced by a single hyphen. It matches the
+// slugs computed by the genres migration.
+func GenreSlug(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(genre.Name == "" || genre.Slug != "", "name", "must contain a letter or digit")
+
+	for _, alias := range genre.Aliases {
+		v.Check(alias != "", "aliases", "must only contain names with a letter or digit")
+		v.Check(alias != genre.Slug, "aliases", fmt.Sprintf("%q is the slug of the genre itself", alias))
+	}
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+}
+
+// GenreCatalogue maps the slug of every genre and alias onto the canonical
+// genre name.
+type GenreCatalogue map[string]string
+
+// Normalise returns the canonical names of the given genres, in the order
+// they were given and with duplicates dropped. Genres which are not in the
+// catalogue are reported as validation errors under key.
+func (c GenreCatalogue) Normalise(v *validator.Validator, key string, genres []string) []string {
+	if genres == nil {
+		return nil
+	}
+
+	canonical := make([]string, 0, len(genres))
+	for _, genre := range genres {
+		name, ok := c[GenreSlug(genre)]
+		if !ok {
+			v.AddError(key, fmt.Sprintf("unknown genre %q", genre))
+			continue
+		}
+		if !validator.In(name, canonical...) {
+			canonical = append(canonical, name)
+		}
+	}
+	return canonical
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+func (m GenreModel) Catalogue() (GenreCatalogue, error) {
+	query := `
+			SELECT genre_aliases.alias, genres.name
+			FROM genre_aliases
+			INNER JOIN genres ON genres.id = genre_aliases.genre_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	catalogue := make(GenreCatalogue)
+
+	for rows.Next() {
+		var alias, name string
+		if err := rows.Scan(&alias, &name); err != nil {
+			return nil, err
+		}
+		catalogue[alias] = name
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return catalogue, nil
+}
+
+// Insert adds a genre to the catalogue along with its aliases, which must be
+// slugs. The genre's own slug is stored as an alias too.
+func (m GenreModel) Insert(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO genres (name, slug) VALUES ($1, $2) RETURNING id`, genre.Name, genre.Slug).Scan(&genre.ID)
+	if err != nil {
+		return duplicateGenreError(err)
+	}
+
+	query := `
+			INSERT INTO genre_aliases (alias, genre_id)
+			SELECT alias, $2 FROM unnest($1::text[]) AS alias`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(append([]string{genre.Slug}, genre.Aliases...)), genre.ID)
+	if err != nil {
+		return duplicateGenreError(err)
+	}
+
+	return tx.Commit()
+}
+
+func duplicateGenreError(err error) error {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "genres_name_key"`,
+		`pq: duplicate key value violates unique constraint "genres_slug_key"`,
+		`pq: duplicate key value violates unique constraint "genre_aliases_pkey"`:
+		return ErrDuplicateGenre
+	default:
+		return err
+	}
+}
+
+func (m GenreModel) GetBySlug(slug string) (*Genre, error) {
+	query := `
+			SELECT id, name, slug,
+				ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id AND alias <> genres.slug ORDER BY alias),
+				(SELECT count(*) FROM movies WHERE genres.name = ANY(movies.genres) AND deleted_at IS NULL)
+			FROM genres
+			WHERE slug = $1`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&genre.ID,
+		&genre.Name,
+		&genre.Slug,
+		pq.Array(&genre.Aliases),
+		&genre.MovieCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &genre, nil
+}
+
+// GetAll returns every genre in the catalogue with the number of movies,
+// outside the trash, filed under it.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+			SELECT genres.id, genres.name, genres.slug,
+				ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id AND alias <> genres.slug ORDER BY alias),
+				count(movies.id)
+			FROM genres
+			LEFT JOIN movies ON genres.name = ANY(movies.genres) AND movies.deleted_at IS NULL
+			GROUP BY genres.id
+			ORDER BY genres.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.Name,
+			&genre.Slug,
+			pq.Array(&genre.Aliases),
+			&genre.MovieCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Merge folds the genre from into the genre into. Every movie filed under
+// from, including those in the trash, is rewritten to use into instead and
+// gets a new revision attributed to userID. The slug and aliases of from
+// become aliases of into, so inputs using them keep resolving. It returns the
+// number of movies rewritten.
+func (m GenreModel) Merge(from, into *Genre, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+			WITH changed AS (
+				UPDATE movies SET
+					genres = CASE WHEN $2 = ANY(genres) THEN array_remove(genres, $1) ELSE array_replace(genres, $1, $2) END,
+					version = version + 1
+				WHERE $1 = ANY(genres)
+				RETURNING id, title, year, runtime, genres, version, poster
+			), ` + recordRevision(3) + `
+			SELECT count(*) FROM changed`
+
+	var rewritten int64
+
+	err = tx.QueryRowContext(ctx, query, from.Name, into.Name, userID).Scan(&rewritten)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE genre_aliases SET genre_id = $1 WHERE genre_id = $2`, into.ID, from.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, from.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return rewritten, tx.Commit()
+}
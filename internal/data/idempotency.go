@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrIdempotencyKeyInUse = errors.New("idempotency key in use")
+
+// StoredResponse is a response saved against an idempotency key so that
+// retries of the request can be answered with it. RequestHash fingerprints
+// the request it answered, so a retry can be told from a different request
+// sent with the same key.
+type StoredResponse struct {
+	RequestHash []byte
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+}
+
+// IdempotencyKey is a key sent by a client, scoped to the user who sent it.
+// Requests made without authenticating all come from the anonymous user, so
+// their keys are also scoped to the address of the client.
+type IdempotencyKey struct {
+	UserID int64
+	Client string
+	Key    string
+}
+
+type IdempotencyKeyModel struct {
+	DB *sql.DB
+}
+
+// Claim reserves a key until expiry, unless it is already taken.
+// It returns nil once the key is reserved, which must be followed by Save or
+// Release. If the key has been used before, the response saved then is
+// returned, or ErrIdempotencyKeyInUse if that request has not been answered
+// yet.
+func (m IdempotencyKeyModel) Claim(key IdempotencyKey, expiry time.Time) (*StoredResponse, error) {
+	query := `
+			INSERT INTO idempotency_keys (user_id, client, key, expiry)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, client, key) DO UPDATE
+				SET request_hash = NULL, status = 0, header = '{}', body = '', expiry = EXCLUDED.expiry
+				WHERE idempotency_keys.expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, key.UserID, key.Client, key.Key, expiry)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 1 {
+		return nil, nil
+	}
+
+	query = `
+			SELECT request_hash, status, header, body
+			FROM idempotency_keys
+			WHERE user_id = $1 AND client = $2 AND key = $3`
+
+	var response StoredResponse
+
+	err = m.DB.QueryRowContext(ctx, query, key.UserID, key.Client, key.Key).Scan(
+		&response.RequestHash,
+		&response.Status,
+		jsonColumn{&response.Header},
+		&response.Body,
+	)
+	if err != nil {
+		switch {
+		// The key was released between the two queries.
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrIdempotencyKeyInUse
+		default:
+			return nil, err
+		}
+	}
+
+	if response.Status == 0 {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	return &response, nil
+}
+
+// Save stores the response to the request a key was claimed for, along with
+// the fingerprint of that request.
+func (m IdempotencyKeyModel) Save(key IdempotencyKey, response *StoredResponse) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			UPDATE idempotency_keys SET request_hash = $1, status = $2, header = $3, body = $4
+			WHERE user_id = $5 AND client = $6 AND key = $7`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, response.RequestHash, response.Status, header, response.Body, key.UserID, key.Client, key.Key)
+	return err
+}
+
+// Release gives up a claimed key without saving a response, so the request
+// can be retried with it.
+func (m IdempotencyKeyModel) Release(key IdempotencyKey) error {
+	query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND client = $2 AND key = $3 AND status = 0`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key.UserID, key.Client, key.Key)
+	return err
+}
+
+// DeleteExpired removes the keys whose responses are no longer replayed and
+// returns how many there were.
+func (m IdempotencyKeyModel) DeleteExpired() (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
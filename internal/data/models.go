@@ -11,17 +11,35 @@ var (
 )
 
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionsModel
+	Movies          MovieModel
+	MovieRevisions  MovieRevisionModel
+	Translations    MovieTranslationModel
+	Reviews         ReviewModel
+	Watchlist       WatchlistModel
+	People          PersonModel
+	Credits         CreditModel
+	Genres          GenreModel
+	Collections     CollectionModel
+	Users           UserModel
+	Tokens          TokenModel
+	IdempotencyKeys IdempotencyKeyModel
+	Permissions     PermissionsModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionsModel{DB: db},
+		Movies:          MovieModel{DB: db},
+		MovieRevisions:  MovieRevisionModel{DB: db},
+		Translations:    MovieTranslationModel{DB: db},
+		Reviews:         ReviewModel{DB: db},
+		Watchlist:       WatchlistModel{DB: db},
+		People:          PersonModel{DB: db},
+		Credits:         CreditModel{DB: db},
+		Genres:          GenreModel{DB: db},
+		Collections:     CollectionModel{DB: db},
+		Users:           UserModel{DB: db},
+		Tokens:          TokenModel{DB: db},
+		IdempotencyKeys: IdempotencyKeyModel{DB: db},
+		Permissions:     PermissionsModel{DB: db},
 	}
 }
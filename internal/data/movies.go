@@ -3,22 +3,64 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
 	"github.com/lib/pq"
 )
 
+var ErrDuplicateMovie = errors.New("duplicate movie")
+
 type Movie struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
 	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	// OriginalTitle and Locale are set when Title has been replaced by a
+	// translation.
+	OriginalTitle string   `json:"original_title,omitempty"`
+	Locale        string   `json:"locale,omitempty"`
+	Year          int32    `json:"year,omitempty"`
+	Runtime       Runtime  `json:"runtime,omitempty"`
+	Genres        []string `json:"genres,omitempty"`
+	Version       int32    `json:"version"`
+	// AverageRating and RatingCount are kept up to date from the reviews table
+	// by a trigger.
+	AverageRating *float64 `json:"average_rating"`
+	RatingCount   int32    `json:"rating_count"`
+	Poster        Poster   `json:"poster_urls,omitempty"`
+	// Similarity is only set on movies returned by GetSimilar.
+	Similarity float64    `json:"similarity,omitempty"`
+	Highlight  string     `json:"highlight,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	// Credits is only filled in when it is asked to be embedded.
+	Credits []*Credit `json:"credits,omitempty"`
+	// Collections lists the collections the movie belongs to, by name.
+	Collections []CollectionSummary `json:"collections,omitempty"`
+	// RuntimeFormat is the format Runtime is written in, or empty for the
+	// default.
+	RuntimeFormat RuntimeFormat `json:"-"`
+	relevance     float32
+}
+
+// MarshalJSON writes the movie with its runtime in RuntimeFormat.
+func (m Movie) MarshalJSON() ([]byte, error) {
+	type movie Movie
+
+	var runtime *formattedRuntime
+	if m.Runtime != 0 {
+		runtime = &formattedRuntime{m.Runtime, m.RuntimeFormat}
+	}
+
+	return json.Marshal(struct {
+		movie
+		Runtime *formattedRuntime `json:"runtime,omitempty"`
+	}{movie(m), runtime})
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -35,44 +77,390 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
 }
 
+// MovieFilters holds the criteria used to narrow down a list of movies. Zero
+// values mean the corresponding filter is not applied.
+type MovieFilters struct {
+	Title         string
+	Genres        []string
+	GenresMode    string
+	ExcludeGenres []string
+	YearMin       int
+	YearMax       int
+	RuntimeMin    int
+	RuntimeMax    int
+	PersonID      int64
+	Highlight     bool
+	// Fields is the sparse fieldset to read. It is empty to read every field.
+	Fields []string
+	// Facets lists the facets to count over the whole result set.
+	Facets []string
+}
+
+func ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
+	v.Check(validator.In(f.GenresMode, "any", "all"), "genres_mode", "must be either any or all")
+
+	v.Check(f.YearMin == 0 || f.YearMin >= 1888, "year_min", "must be greater than 1888")
+	v.Check(f.YearMax == 0 || f.YearMax >= 1888, "year_max", "must be greater than 1888")
+	v.Check(f.YearMin == 0 || f.YearMax == 0 || f.YearMin <= f.YearMax, "year_min", "must not be greater than year_max")
+
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(f.RuntimeMin == 0 || f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+
+	v.Check(f.PersonID >= 0, "person_id", "must not be negative")
+}
+
+// args returns the query arguments for the placeholders $1 to $9 used by
+// MovieModel.filterConditions.
+func (f MovieFilters) args() []interface{} {
+	return []interface{}{
+		titleQuery(f.Title),
+		pq.Array(f.Genres),
+		f.GenresMode,
+		pq.Array(f.ExcludeGenres),
+		f.YearMin,
+		f.YearMax,
+		f.RuntimeMin,
+		f.RuntimeMax,
+		f.PersonID,
+	}
+}
+
+// MovieFieldSafelist lists the fields of a movie which can be asked for in a
+// sparse fieldset.
+var MovieFieldSafelist = []string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count", "poster_urls", "collections", "highlight"}
+
+// movieFacets holds the query counting the buckets of each facet. The %s
+// verb takes MovieModel.filterConditions so the counts cover exactly the
+// movies being listed.
+var movieFacets = map[string]string{
+	"genres": `
+			SELECT genre, count(*) FROM movies, unnest(genres) AS genre
+			WHERE %s
+			GROUP BY genre
+			ORDER BY count(*) DESC, genre`,
+	"decade": `
+			SELECT (year / 10 * 10)::text || 's', count(*) FROM movies
+			WHERE %s
+			GROUP BY year / 10
+			ORDER BY year / 10`,
+}
+
+func ValidateMovieFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		_, ok := movieFacets[facet]
+		v.Check(ok, "facets", fmt.Sprintf("unknown facet %q", facet))
+	}
+	v.Check(validator.Unique(facets), "facets", "must not contain duplicate values")
+}
+
+func ValidateMovieFields(v *validator.Validator, fields []string) {
+	for _, field := range fields {
+		v.Check(validator.In(field, MovieFieldSafelist...), "fields", fmt.Sprintf("unknown field %q", field))
+	}
+}
+
+// movieColumns returns the columns to read for a sparse fieldset. The id,
+// created_at and version columns are always read, as are any extra columns a
+// query depends on, such as the one it sorts by.
+func movieColumns(fields []string, extra ...string) []string {
+	columns := []string{"id", "created_at", "version"}
+
+	for _, column := range []string{"title", "year", "runtime", "genres", "average_rating", "rating_count", "poster", movieCollectionsColumn} {
+		field := column
+		switch column {
+		case "poster":
+			field = "poster_urls"
+		case movieCollectionsColumn:
+			field = "collections"
+		}
+		if len(fields) == 0 || validator.In(field, fields...) || validator.In(column, extra...) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// scanDest returns the destinations to scan the given columns into.
+func (movie *Movie) scanDest(columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &movie.ID
+		case "created_at":
+			dest[i] = &movie.CreatedAt
+		case "title":
+			dest[i] = &movie.Title
+		case "year":
+			dest[i] = &movie.Year
+		case "runtime":
+			dest[i] = &movie.Runtime
+		case "genres":
+			dest[i] = pq.Array(&movie.Genres)
+		case "version":
+			dest[i] = &movie.Version
+		case "average_rating":
+			dest[i] = &movie.AverageRating
+		case "rating_count":
+			dest[i] = &movie.RatingCount
+		case "poster":
+			dest[i] = &movie.Poster
+		case movieCollectionsColumn:
+			dest[i] = jsonColumn{&movie.Collections}
+		}
+	}
+	return dest
+}
+
 type MovieModel struct {
 	DB *sql.DB
+	// SearchConfig names the PostgreSQL text search configuration used to
+	// match titles. It must match the one movies_title_idx is built with for
+	// the index to be used.
+	SearchConfig string
+}
+
+// titleQuery turns free text into a to_tsquery expression in which every word
+// is matched as a prefix, so partially typed words still find their titles.
+func titleQuery(title string) string {
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i := range words {
+		words[i] += ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// filterConditions returns the WHERE conditions that apply MovieFilters to
+// the movies table, with the arguments given by MovieFilters.args.
+func (m MovieModel) filterConditions() string {
+	return fmt.Sprintf(`deleted_at IS NULL
+			AND ($1 = ''
+				OR to_tsvector(%[1]s, title) @@ to_tsquery(%[1]s, $1)
+				OR EXISTS (
+					SELECT 1 FROM movie_translations
+					WHERE movie_translations.movie_id = movies.id
+					AND to_tsvector(%[1]s, movie_translations.title) @@ to_tsquery(%[1]s, $1)
+				))
+			AND ($2 = '{}' OR ($3 = 'all' AND genres @> $2) OR ($3 = 'any' AND genres && $2))
+			AND NOT genres && $4
+			AND (year >= $5 OR $5 = 0)
+			AND (year <= $6 OR $6 = 0)
+			AND (runtime >= $7 OR $7 = 0)
+			AND (runtime <= $8 OR $8 = 0)
+			AND ($9 = 0 OR EXISTS (SELECT 1 FROM movie_credits WHERE movie_id = movies.id AND person_id = $9))`, pq.QuoteLiteral(m.SearchConfig))
+}
+
+// sortExpression maps a sort column onto the SQL expression it orders by.
+// Relevance is wanted best match first, so the rank is negated to let it
+// share the ASC/DESC and cursor handling of the plain columns. Movies without
+// any ratings sort as if they were rated zero.
+func (m MovieModel) sortExpression(column string) string {
+	switch column {
+	case "relevance":
+		return "-" + m.rankExpression()
+	case "rating":
+		return "COALESCE(average_rating, 0)"
+	}
+	return column
+}
+
+// rankExpression ranks a movie by the best match among its title and its
+// translated titles.
+func (m MovieModel) rankExpression() string {
+	return fmt.Sprintf(`GREATEST(
+				ts_rank(to_tsvector(%[1]s, title), to_tsquery(%[1]s, $1)),
+				(SELECT max(ts_rank(to_tsvector(%[1]s, movie_translations.title), to_tsquery(%[1]s, $1)))
+				FROM movie_translations WHERE movie_translations.movie_id = movies.id)
+			)`, pq.QuoteLiteral(m.SearchConfig))
+}
+
+// movieInsert adds a movie and records it as the first revision, made by the
+// user given by $5.
+var movieInsert = `
+			WITH changed AS (
+				INSERT INTO movies (title, year, runtime, genres) VALUES ($1, $2, $3, $4)
+				RETURNING id, created_at, title, year, runtime, genres, version, poster
+			), ` + recordRevision(5) + `
+			SELECT id, created_at, version FROM changed`
+
+// Insert adds a movie and records it as the first revision, made by the user
+// with the given ID.
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), userID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, movieInsert, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
-	query := `INSERT INTO movies (title, year, runtime, genres) VALUES ($1, $2, $3, $4) RETURNING id, created_at, version`
+// normalisedTitle is the SQL expression titles are compared by when looking
+// for duplicates: lower case, with every run of punctuation and spaces
+// reduced to a single space. It matches movies_normalised_title_year_idx.
+const normalisedTitle = `trim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g'))`
+
+// InsertUnique is Insert for a movie which must not duplicate one outside the
+// trash with the same year and normalised title. If there is one, nothing is
+// inserted and its ID is returned with ErrDuplicateMovie. Movies with the
+// same title and year are inserted one at a time, so two of them sent
+// together cannot both pass the check.
+func (m MovieModel) InsertUnique(movie *Movie, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+			SELECT pg_advisory_xact_lock(hashtext(
+				trim(regexp_replace(lower($1), '[^[:alnum:]]+', ' ', 'g')) || ':' || $2::integer
+			))`
+
+	_, err = tx.ExecContext(ctx, query, movie.Title, movie.Year)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+			SELECT id FROM movies
+			WHERE ` + normalisedTitle + ` = trim(regexp_replace(lower($1), '[^[:alnum:]]+', ' ', 'g'))
+			AND year = $2 AND deleted_at IS NULL
+			ORDER BY id
+			LIMIT 1`
 
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	var existingID int64
+
+	err = tx.QueryRowContext(ctx, query, movie.Title, movie.Year).Scan(&existingID)
+	switch {
+	case err == nil:
+		return existingID, ErrDuplicateMovie
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), userID}
+
+	err = tx.QueryRowContext(ctx, movieInsert, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, tx.Commit()
+}
+
+// MovieImport inserts movies in batches. An atomic import writes every batch
+// in one transaction, which only takes effect once Commit is called.
+type MovieImport struct {
+	db     *sql.DB
+	tx     *sql.Tx
+	userID int64
+}
+
+func (m MovieModel) NewImport(atomic bool, userID int64) (*MovieImport, error) {
+	if !atomic {
+		return &MovieImport{db: m.DB, userID: userID}, nil
+	}
+
+	tx, err := m.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MovieImport{db: m.DB, tx: tx, userID: userID}, nil
+}
+
+func (i *MovieImport) Insert(movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	values := make([]string, len(movies))
+	args := make([]interface{}, 0, len(movies)*4+1)
+	args = append(args, i.userID)
+
+	for j, movie := range movies {
+		n := len(args)
+		values[j] = fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+		args = append(args, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres))
+	}
+
+	query := `
+			WITH changed AS (
+				INSERT INTO movies (title, year, runtime, genres) VALUES ` + strings.Join(values, ", ") + `
+				RETURNING id, created_at, title, year, runtime, genres, version, poster
+			), ` + recordRevision(1) + `
+			SELECT id, created_at, version FROM changed ORDER BY id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	var rows *sql.Rows
+	var err error
+	if i.tx != nil {
+		rows, err = i.tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = i.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The ids are handed out in the order the VALUES rows were given.
+	for j := 0; rows.Next(); j++ {
+		err := rows.Scan(&movies[j].ID, &movies[j].CreatedAt, &movies[j].Version)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (i *MovieImport) Commit() error {
+	if i.tx == nil {
+		return nil
+	}
+	return i.tx.Commit()
+}
+
+func (i *MovieImport) Rollback() error {
+	if i.tx == nil {
+		return nil
+	}
+	return i.tx.Rollback()
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	return m.GetFields(id, nil)
+}
+
+// GetFields fetches a movie, reading only the columns needed for a sparse
+// fieldset.
+func (m MovieModel) GetFields(id int64, fields []string) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
+
+	columns := movieColumns(fields)
+
 	query := `
-					SELECT id, created_at, title, year, runtime, genres, version
+					SELECT ` + strings.Join(columns, ", ") + `
 					FROM movies
-					WHERE id = $1`
+					WHERE id = $1 AND deleted_at IS NULL`
 	var movie Movie
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(movie.scanDest(columns)...)
 
 	if err != nil {
 		switch {
@@ -85,22 +473,111 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// GetByIDs fetches the movies with the given ids in a single query, reading
+// only the columns needed for a sparse fieldset. The movies come back in the
+// order of ids; those which do not exist or are in the trash are left out.
+func (m MovieModel) GetByIDs(ids []int64, fields []string) ([]*Movie, error) {
+	columns := movieColumns(fields)
+
+	query := `
+			SELECT ` + strings.Join(columns, ", ") + `
+			FROM movies
+			WHERE id = ANY($1) AND deleted_at IS NULL
+			ORDER BY array_position($1, id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(movie.scanDest(columns)...)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+func (m MovieModel) GetAll(criteria MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+
+	var c cursor
+	if filters.Cursor != "" {
+		var err error
+		c, err = decodeCursor(filters.Cursor)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	column, direction := m.sortExpression(filters.sortColumn()), filters.sortDirection()
+
+	// In cursor mode the total is not counted, as that would need a scan of
+	// every matching row and defeat the point of seeking past the cursor.
+	total := "count(*) OVER()"
+	keyset := ""
+	args := append(criteria.args(), criteria.Highlight)
+
+	if filters.Cursor != "" {
+		total = "0"
+		idDirection := ">"
+		if c.Backward {
+			idDirection = "<"
+			direction = reverseDirection(direction)
+		}
+		keyset = fmt.Sprintf("AND (%[1]s %[2]s $%[4]d OR (%[1]s = $%[4]d AND id %[3]s $%[5]d))",
+			column, filters.keysetDirection(c.Backward), idDirection, len(args)+1, len(args)+2)
+		args = append(args, c.Value, c.ID, filters.limit()+1, 0)
+	} else {
+		args = append(args, filters.limit(), filters.offset())
+	}
+
+	idOrder := "ASC"
+	if c.Backward {
+		idOrder = "DESC"
+	}
+
+	config := pq.QuoteLiteral(m.SearchConfig)
+	sortField := filters.sortColumn()
+	if sortField == "rating" {
+		sortField = "average_rating"
+	}
+	columns := movieColumns(criteria.Fields, sortField)
+
+	// The rank is only read back to build cursors for the relevance sort, so
+	// other sorts skip computing it for every row.
+	rank := "0"
+	if filters.sortColumn() == "relevance" {
+		rank = m.rankExpression()
+	}
 
 	query := fmt.Sprintf(`
-			SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+			SELECT %[1]s, `+strings.Join(columns, ", ")+`,
+				CASE WHEN $10 AND $1 <> '' THEN ts_headline(%[2]s, title, to_tsquery(%[2]s, $1)) ELSE '' END,
+				%[3]s
 			FROM movies
-			WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-			AND (genres @> $2 OR $2 = '{}')
-			ORDER BY %s %s, id ASC
-			LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+			WHERE %[4]s
+			%[5]s
+			ORDER BY %[6]s %[7]s, id %[8]s
+			LIMIT $%[9]d OFFSET $%[10]d`, total, config, rank, m.filterConditions(), keyset, column, direction, idOrder, len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -112,16 +589,11 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	for rows.Next() {
 		var movie Movie
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+
+		dest := append([]interface{}{&totalRecords}, movie.scanDest(columns)...)
+		dest = append(dest, &movie.Highlight, &movie.relevance)
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -130,21 +602,226 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	facets, err := m.facets(ctx, criteria)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Cursor == "" {
+		metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+		hasPrev := filters.Page > 1
+		hasNext := filters.offset()+len(movies) < totalRecords
+		metadata.NextCursor, metadata.PrevCursor = movieCursors(movies, filters, hasPrev, hasNext)
+		metadata.Facets = facets
+		return movies, metadata, nil
+	}
+
+	// One extra row was requested to find out whether there is another page
+	// beyond this one in the direction of travel.
+	more := len(movies) > filters.limit()
+	if more {
+		movies = movies[:filters.limit()]
+	}
+
+	hasPrev, hasNext := true, more
+	if c.Backward {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+		hasPrev, hasNext = more, true
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize, Facets: facets}
+	metadata.NextCursor, metadata.PrevCursor = movieCursors(movies, filters, hasPrev, hasNext)
 
 	return movies, metadata, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
-	query := `UPDATE movies SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1 WHERE id = $5 AND version = $6 RETURNING version`
+// facets counts the buckets of every facet asked for in criteria, or returns
+// nil if there are none.
+func (m MovieModel) facets(ctx context.Context, criteria MovieFilters) (map[string][]FacetBucket, error) {
+	if len(criteria.Facets) == 0 {
+		return nil, nil
+	}
+
+	facets := make(map[string][]FacetBucket, len(criteria.Facets))
+
+	for _, facet := range criteria.Facets {
+		rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(movieFacets[facet], m.filterConditions()), criteria.args()...)
+		if err != nil {
+			return nil, err
+		}
+
+		buckets := []FacetBucket{}
+		for rows.Next() {
+			var bucket FacetBucket
+			if err := rows.Scan(&bucket.Value, &bucket.Count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			buckets = append(buckets, bucket)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		facets[facet] = buckets
+	}
+	return facets, nil
+}
+
+// movieCursors builds the cursors pointing after the last movie and before the
+// first movie of a page.
+func movieCursors(movies []*Movie, filters Filters, hasPrev, hasNext bool) (next, prev string) {
+	if len(movies) == 0 {
+		return "", ""
+	}
+
+	column := filters.sortColumn()
+
+	if hasNext {
+		last := movies[len(movies)-1]
+		next = encodeCursor(cursor{Sort: filters.Sort, Value: last.sortValue(column), ID: last.ID})
+	}
+	if hasPrev {
+		first := movies[0]
+		prev = encodeCursor(cursor{Sort: filters.Sort, Value: first.sortValue(column), ID: first.ID, Backward: true})
+	}
+	return next, prev
+}
+
+func (movie *Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(movie.Runtime), 10)
+	case "relevance":
+		return strconv.FormatFloat(float64(-movie.relevance), 'g', -1, 32)
+	case "rating":
+		if movie.AverageRating == nil {
+			return "0"
+		}
+		return strconv.FormatFloat(*movie.AverageRating, 'f', 2, 64)
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
+// Export streams every movie matching the filters to fn in id order, without
+// holding more than the current row in memory. It stops at the first error
+// returned by fn or when ctx is cancelled.
+func (m MovieModel) Export(ctx context.Context, criteria MovieFilters, fn func(*Movie) error) error {
+	columns := movieColumns(nil)
+
+	query := fmt.Sprintf(`
+			SELECT `+strings.Join(columns, ", ")+`
+			FROM movies
+			WHERE %s
+			ORDER BY id ASC`, m.filterConditions())
+
+	rows, err := m.DB.QueryContext(ctx, query, criteria.args()...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(movie.scanDest(columns)...)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+type MovieSuggestion struct {
+	ID    int64   `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// suggestionThreshold is the lowest word similarity a title may have to the
+// search text and still be suggested. It is lower than the pg_trgm default so
+// that misspelt words are still found.
+const suggestionThreshold = "0.3"
+
+func (m MovieModel) Suggest(q string, limit int) ([]*MovieSuggestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, suggestionThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+			SELECT id, title, word_similarity($1, title) AS score
+			FROM movies
+			WHERE $1 <% title AND deleted_at IS NULL
+			ORDER BY score DESC, id ASC
+			LIMIT $2`
+
+	rows, err := tx.QueryContext(ctx, query, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Score)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, tx.Commit()
+}
+
+// Update saves the movie if it is still at the version it was read at, and
+// records the result as a new revision made by the user with the given ID.
+func (m MovieModel) Update(movie *Movie, userID int64) error {
+	query := `
+			WITH changed AS (
+				UPDATE movies SET title = $1, year = $2, runtime = $3, genres = $4, poster = $5, version = version + 1
+				WHERE id = $6 AND version = $7 AND deleted_at IS NULL
+				RETURNING id, title, year, runtime, genres, version, poster
+			), ` + recordRevision(8) + `
+			SELECT version FROM changed`
 
 	args := []interface{}{
 		movie.Title,
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.Poster,
 		movie.ID,
 		movie.Version,
+		userID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -162,18 +839,153 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m MovieModel) Delete(id int64) error {
+// SetPoster replaces the poster of a movie, bumping its version and recording
+// a revision attributed to userID. It returns the poster it replaced so its
+// files can be removed.
+func (m MovieModel) SetPoster(movie *Movie, poster Poster, userID int64) (Poster, error) {
+	query := `
+			WITH previous AS (
+				SELECT id, poster FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+			), changed AS (
+				UPDATE movies SET poster = $2, version = movies.version + 1
+				FROM previous
+				WHERE movies.id = previous.id
+				RETURNING movies.id, movies.title, movies.year, movies.runtime, movies.genres, movies.version, movies.poster,
+					previous.poster AS replaced
+			), ` + recordRevision(3) + `
+			SELECT version, replaced FROM changed`
+
+	var replaced Poster
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movie.ID, poster, userID).Scan(&movie.Version, &replaced)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	movie.Poster = poster
+	return replaced, nil
+}
+
+// Merge folds source into target and moves source to the trash, where its
+// revisions are kept until it is purged. The target is saved with its current
+// fields, which should already include the genres of both, as a new version
+// attributed to userID; it takes the poster of the source if it has none of
+// its own. Reviews, watchlist entries, credits, translations and collection
+// items of the source move to the target unless the target already has an
+// equivalent one.
+func (m MovieModel) Merge(source, target *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+			WITH changed AS (
+				UPDATE movies SET
+					title = $1, year = $2, runtime = $3, genres = $4,
+					poster = CASE WHEN poster = '' THEN $5 ELSE poster END,
+					version = version + 1
+				WHERE id = $6 AND version = $7 AND deleted_at IS NULL
+				RETURNING id, title, year, runtime, genres, version, poster
+			), ` + recordRevision(8) + `
+			SELECT version, poster FROM changed`
+
+	args := []interface{}{
+		target.Title,
+		target.Year,
+		target.Runtime,
+		pq.Array(target.Genres),
+		source.Poster,
+		target.ID,
+		target.Version,
+		userID,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&target.Version, &target.Poster)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflit
+		default:
+			return err
+		}
+	}
+
+	moves := []string{
+		`UPDATE collection_items SET movie_id = $2 WHERE movie_id = $1
+			AND collection_id NOT IN (SELECT collection_id FROM collection_items WHERE movie_id = $2)`,
+		`UPDATE reviews SET movie_id = $2 WHERE movie_id = $1
+			AND user_id NOT IN (SELECT user_id FROM reviews WHERE movie_id = $2)`,
+		`UPDATE watchlist SET movie_id = $2 WHERE movie_id = $1
+			AND user_id NOT IN (SELECT user_id FROM watchlist WHERE movie_id = $2)`,
+		`UPDATE movie_translations SET movie_id = $2 WHERE movie_id = $1
+			AND locale NOT IN (SELECT locale FROM movie_translations WHERE movie_id = $2)`,
+		`UPDATE movie_credits SET movie_id = $2 WHERE movie_id = $1
+			AND NOT EXISTS (
+				SELECT 1 FROM movie_credits AS existing
+				WHERE existing.movie_id = $2 AND existing.person_id = movie_credits.person_id AND existing.role = movie_credits.role
+			)`,
+	}
+	for _, move := range moves {
+		_, err = tx.ExecContext(ctx, move, source.ID, target.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT `+movieCollectionsColumn+` FROM movies WHERE id = $1`, target.ID).Scan(jsonColumn{&target.Collections})
+	if err != nil {
+		return err
+	}
+
+	// A poster taken over by the target must not be removed when the source
+	// is purged.
+	query = `
+			UPDATE movies SET deleted_at = NOW(), poster = CASE WHEN poster = $3 THEN '' ELSE poster END
+			WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, source.ID, source.Version, target.Poster)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflit
+	}
+
+	return tx.Commit()
+}
+
+// Delete moves a movie to the trash. It stays there, hidden from every other
+// query, until it is restored or purged. A non-zero version restricts the
+// delete to that version of the movie.
+func (m MovieModel) Delete(id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM movies WHERE id = $1`
+	query := `UPDATE movies SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND (version = $2 OR $2 = 0)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -188,3 +1000,191 @@ func (m MovieModel) Delete(id int64) error {
 	}
 	return nil
 }
+
+// The weights of the parts of the score GetSimilar ranks movies by. Each part
+// is between 0 and 1, so the score is too.
+const (
+	similarGenresWeight  = 0.6
+	similarYearWeight    = 0.2
+	similarRuntimeWeight = 0.2
+)
+
+// GetSimilar returns the movies most like the given one, best match first.
+// Movies are scored on the Jaccard index of their genres and on how close
+// their year and runtime are, halving the year part every 10 years apart and
+// the runtime part every 30 minutes apart. Only movies sharing at least one
+// genre are considered, which lets the genres index narrow the candidates.
+func (m MovieModel) GetSimilar(movie *Movie, filters Filters) ([]*Movie, Metadata, error) {
+	columns := movieColumns(nil)
+
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), `+strings.Join(columns, ", ")+`, score.similarity
+			FROM movies, LATERAL (
+				SELECT round((
+					%f * (SELECT count(*) FROM unnest(movies.genres) AS genre WHERE genre = ANY($2))::numeric
+						/ (SELECT count(DISTINCT genre) FROM unnest(movies.genres || $2::text[]) AS genre)
+					+ %f * power(0.5, abs(movies.year - $3) / 10.0)
+					+ %f * power(0.5, abs(movies.runtime - $4) / 30.0)
+				), 4) AS similarity
+			) AS score
+			WHERE movies.genres && $2 AND movies.id <> $1 AND movies.deleted_at IS NULL
+			ORDER BY score.similarity DESC, movies.id ASC
+			LIMIT $5 OFFSET $6`, similarGenresWeight, similarYearWeight, similarRuntimeWeight)
+
+	args := []interface{}{movie.ID, pq.Array(movie.Genres), movie.Year, movie.Runtime, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var similar Movie
+
+		dest := append([]interface{}{&totalRecords}, similar.scanDest(columns)...)
+		dest = append(dest, &similar.Similarity)
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &similar)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MovieModel) GetDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	columns := movieColumns(nil)
+
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), `+strings.Join(columns, ", ")+`, deleted_at
+			FROM movies
+			WHERE deleted_at IS NOT NULL
+			ORDER BY %s %s, id ASC
+			LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		dest := append([]interface{}{&totalRecords}, movie.scanDest(columns)...)
+		dest = append(dest, &movie.DeletedAt)
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Restore takes a movie out of the trash. Restoring counts as a change, so
+// the version is bumped and a revision is recorded for it.
+func (m MovieModel) Restore(id int64, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// The movies table is read as it was before the update, so the version
+	// is taken from the updated row.
+	columns := movieColumns(nil)
+	selected := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "version":
+			selected[i] = "changed.version"
+		case movieCollectionsColumn:
+			selected[i] = column
+		default:
+			selected[i] = "movies." + column
+		}
+	}
+
+	query := `
+			WITH changed AS (
+				UPDATE movies SET deleted_at = NULL, version = version + 1
+				WHERE id = $1 AND deleted_at IS NOT NULL
+				RETURNING id, created_at, title, year, runtime, genres, version, poster
+			), ` + recordRevision(2) + `
+			SELECT ` + strings.Join(selected, ", ") + `
+			FROM movies
+			INNER JOIN changed ON changed.id = movies.id`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(movie.scanDest(columns)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// PurgeDeleted permanently removes the movies which have been in the trash
+// for longer than retention. It returns how many were removed along with the
+// posters they had, whose files are left for the caller to delete.
+func (m MovieModel) PurgeDeleted(retention time.Duration) (int64, []Poster, error) {
+	query := `DELETE FROM movies WHERE deleted_at < NOW() - make_interval(secs => $1) RETURNING poster`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var purged int64
+	posters := []Poster{}
+
+	for rows.Next() {
+		var poster Poster
+		if err := rows.Scan(&poster); err != nil {
+			return 0, nil, err
+		}
+		purged++
+		if poster != "" {
+			posters = append(posters, poster)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return purged, posters, nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestModels connects to the migrated database named by TEST_DB_DSN,
+// skipping the test if there is none.
+func newTestModels(t *testing.T) Models {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	models := NewModels(db)
+	models.Movies.SearchConfig = "movies_search"
+	return models
+}
+
+// insertRatedMovie adds a movie reviewed by a new user with the given score,
+// returning the movie and the ID of the user.
+func insertRatedMovie(t *testing.T, models Models, score int32) (*Movie, int64) {
+	t.Helper()
+
+	var userID int64
+	err := models.Users.DB.QueryRow(
+		`INSERT INTO users (name, email, password_hash, activated) VALUES ('Rater', $1, '\x00', true) RETURNING id`,
+		fmt.Sprintf("rater-%d@example.com", time.Now().UnixNano()),
+	).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, userID) })
+
+	movie := &Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"Crime"}}
+	if err := models.Movies.Insert(movie, userID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.Movies.DB.Exec(`DELETE FROM movies WHERE id = $1`, movie.ID) })
+
+	if err := models.Reviews.Insert(&Review{MovieID: movie.ID, UserID: userID, Score: score}); err != nil {
+		t.Fatal(err)
+	}
+	return movie, userID
+}
+
+func checkRating(t *testing.T, step string, movie *Movie, want float64) {
+	t.Helper()
+
+	if movie.AverageRating == nil || *movie.AverageRating != want || movie.RatingCount != 1 {
+		t.Errorf("%s: got average_rating %v and rating_count %d; want %g and 1", step, movie.AverageRating, movie.RatingCount, want)
+	}
+}
+
+func TestRatingSurvivesExportAndRestore(t *testing.T) {
+	models := newTestModels(t)
+	movie, userID := insertRatedMovie(t, models, 8)
+
+	criteria := MovieFilters{Genres: []string{}, GenresMode: "all", ExcludeGenres: []string{}}
+
+	var exported *Movie
+	err := models.Movies.Export(context.Background(), criteria, func(m *Movie) error {
+		if m.ID == movie.ID {
+			exported = m
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported == nil {
+		t.Fatal("export: movie not found")
+	}
+	checkRating(t, "export", exported, 8)
+
+	if err := models.Movies.Delete(movie.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, _, err := models.Movies.GetDeleted(Filters{Page: 1, PageSize: 100, Sort: "-id", SortSafelist: []string{"-id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trashed *Movie
+	for _, m := range deleted {
+		if m.ID == movie.ID {
+			trashed = m
+		}
+	}
+	if trashed == nil {
+		t.Fatal("trash: movie not found")
+	}
+	checkRating(t, "trash", trashed, 8)
+
+	restored, err := models.Movies.Restore(movie.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRating(t, "restore", restored, 8)
+	if restored.Version != movie.Version+1 {
+		t.Errorf("restore: got version %d; want %d", restored.Version, movie.Version+1)
+	}
+}
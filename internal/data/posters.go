@@ -0,0 +1,40 @@
+package data
+
+import (
+	"encoding/json"
+	"path"
+)
+
+// PosterURLPrefix is the path the API serves stored poster files under.
+const PosterURLPrefix = "/v1/posters/"
+
+// PosterSizes lists the widths, in pixels, of the thumbnails generated for
+// every poster, keyed by the name they are published under.
+var PosterSizes = map[string]int{
+	"w92":  92,
+	"w185": 185,
+	"w342": 342,
+}
+
+// Poster is the storage key of a movie's original poster image, or empty if
+// the movie has none. Its thumbnails are stored alongside it as JPEGs.
+type Poster string
+
+// Thumbnail returns the storage key of the thumbnail with the given name.
+func (p Poster) Thumbnail(name string) string {
+	return path.Join(path.Dir(string(p)), name+".jpg")
+}
+
+// MarshalJSON writes the poster as the URLs of the original image and of
+// each of its thumbnails.
+func (p Poster) MarshalJSON() ([]byte, error) {
+	if p == "" {
+		return []byte("null"), nil
+	}
+
+	urls := map[string]string{"original": PosterURLPrefix + string(p)}
+	for name := range PosterSizes {
+		urls[name] = PosterURLPrefix + p.Thumbnail(name)
+	}
+	return json.Marshal(urls)
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type MovieRevision struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   Runtime   `json:"runtime"`
+	Genres    []string  `json:"genres"`
+	Poster    Poster    `json:"poster_urls,omitempty"`
+	UserID    *int64    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// RuntimeFormat is the format Runtime is written in, or empty for the
+	// default.
+	RuntimeFormat RuntimeFormat `json:"-"`
+}
+
+// MarshalJSON writes the revision with its runtime in RuntimeFormat.
+func (r MovieRevision) MarshalJSON() ([]byte, error) {
+	type revision MovieRevision
+
+	return json.Marshal(struct {
+		revision
+		Runtime formattedRuntime `json:"runtime"`
+	}{revision(r), formattedRuntime{r.Runtime, r.RuntimeFormat}})
+}
+
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DiffRevisions returns the fields which differ between two revisions of a
+// movie, keyed by their JSON name.
+func DiffRevisions(from, to *MovieRevision) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+
+	if from.Title != to.Title {
+		changes["title"] = FieldChange{From: from.Title, To: to.Title}
+	}
+	if from.Year != to.Year {
+		changes["year"] = FieldChange{From: from.Year, To: to.Year}
+	}
+	if from.Runtime != to.Runtime {
+		changes["runtime"] = FieldChange{
+			From: formattedRuntime{from.Runtime, from.RuntimeFormat},
+			To:   formattedRuntime{to.Runtime, to.RuntimeFormat},
+		}
+	}
+	if !reflect.DeepEqual(from.Genres, to.Genres) {
+		changes["genres"] = FieldChange{From: from.Genres, To: to.Genres}
+	}
+	if from.Poster != to.Poster {
+		changes["poster_urls"] = FieldChange{From: from.Poster, To: to.Poster}
+	}
+	return changes
+}
+
+// recordRevision returns a CTE which stores every row returned by a preceding
+// data-modifying CTE named "changed" as a revision, attributed to the user ID
+// in the given placeholder. Writing the revision in the same statement as the
+// change means one can never be saved without the other.
+func recordRevision(userParam int) string {
+	return fmt.Sprintf(`revision AS (
+				INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, poster, user_id)
+				SELECT id, version, title, year, runtime, genres, poster, $%d FROM changed
+			)`, userParam)
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+func (m MovieRevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), id, movie_id, version, title, year, runtime, genres, poster, user_id, created_at
+			FROM movie_revisions
+			WHERE movie_id = $1
+			ORDER BY %s %s, id ASC
+			LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+		err := rows.Scan(
+			&totalRecords,
+			&revision.ID,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Title,
+			&revision.Year,
+			&revision.Runtime,
+			pq.Array(&revision.Genres),
+			&revision.Poster,
+			&revision.UserID,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MovieRevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	query := `
+			SELECT id, movie_id, version, title, year, runtime, genres, poster, user_id, created_at
+			FROM movie_revisions
+			WHERE movie_id = $1 AND version = $2`
+
+	var revision MovieRevision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.ID,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Year,
+		&revision.Runtime,
+		pq.Array(&revision.Genres),
+		&revision.Poster,
+		&revision.UserID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
@@ -3,38 +3,155 @@ package data
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
+// runtimeFormatsHint lists the accepted runtime formats for error messages.
+const runtimeFormatsHint = `must be a number of minutes, such as 102, "102 mins", "1h 42m" or "PT1H42M"`
+
+// RuntimeFormat is a way of writing a Runtime in JSON.
+type RuntimeFormat string
+
+const (
+	// RuntimeMins writes a runtime as a string such as "102 mins". It is the
+	// format used unless another is asked for.
+	RuntimeMins RuntimeFormat = "mins"
+	// RuntimeMinutes writes a runtime as a plain integer number of minutes.
+	RuntimeMinutes RuntimeFormat = "minutes"
+	// RuntimeISO8601 writes a runtime as an ISO 8601 duration such as
+	// "PT1H42M".
+	RuntimeISO8601 RuntimeFormat = "iso8601"
+)
+
+var RuntimeFormats = []string{string(RuntimeMins), string(RuntimeMinutes), string(RuntimeISO8601)}
+
 type Runtime int32
 
 func (r Runtime) MarshalJSON() ([]byte, error) {
-	jsonValue := fmt.Sprintf("%d mins", r)
-	quotedJSONValue := strconv.Quote(jsonValue)
-	return []byte(quotedJSONValue), nil
+	return r.MarshalJSONFormat(RuntimeMins)
+}
 
+// MarshalJSONFormat writes the runtime in the given format.
+func (r Runtime) MarshalJSONFormat(format RuntimeFormat) ([]byte, error) {
+	if format == RuntimeMinutes {
+		return []byte(r.FormatAs(format)), nil
+	}
+	return []byte(strconv.Quote(r.FormatAs(format))), nil
 }
 
-func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+// FormatAs writes the runtime as text in the given format, which is the
+// default "<n> mins" form if it is empty.
+func (r Runtime) FormatAs(format RuntimeFormat) string {
+	switch format {
+	case RuntimeMinutes:
+		return strconv.FormatInt(int64(r), 10)
+	case RuntimeISO8601:
+		duration := "PT"
+		if hours := r / 60; hours > 0 {
+			duration += fmt.Sprintf("%dH", hours)
+		}
+		if minutes := r % 60; minutes > 0 || r < 60 {
+			duration += fmt.Sprintf("%dM", minutes)
+		}
+		return duration
+	default:
+		return fmt.Sprintf("%d mins", r)
 	}
+}
+
+// formattedRuntime writes a runtime in a format chosen for the response it
+// is part of, for the types which carry such a format.
+type formattedRuntime struct {
+	runtime Runtime
+	format  RuntimeFormat
+}
+
+func (r formattedRuntime) MarshalJSON() ([]byte, error) {
+	return r.runtime.MarshalJSONFormat(r.format)
+}
+
+var (
+	runtimeHoursMinutesRX = regexp.MustCompile(`^(?:(\d+)\s*h(?:rs?|ours?)?)?\s*(?:(\d+)\s*m(?:ins?|inutes?)?)?$`)
+	runtimeISO8601RX      = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+)
 
-	parts := strings.Split(unquotedJSONValue, " ")
+// UnmarshalJSON accepts a runtime as a JSON number of minutes or as a string
+// holding a number of minutes, "<n> mins", hours and minutes such as
+// "1h 42m", or an ISO 8601 duration such as "PT1H42M".
+func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	value := string(jsonValue)
 
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = strings.TrimSpace(unquoted)
+	} else if strings.HasPrefix(value, `"`) {
+		return fmt.Errorf("%w: %s", ErrInvalidRuntimeFormat, runtimeFormatsHint)
 	}
 
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	minutes, err := parseRuntime(value)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return err
 	}
 
-	*r = Runtime(i)
+	*r = Runtime(minutes)
 	return nil
 }
+
+func parseRuntime(value string) (int64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRuntimeFormat, runtimeFormatsHint)
+	}
+
+	// A bare number, or one followed by min or mins.
+	number := strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(value, "mins"), "min"))
+	if i, err := strconv.ParseInt(number, 10, 32); err == nil {
+		return i, nil
+	}
+	if _, err := strconv.ParseFloat(number, 64); err == nil {
+		return 0, fmt.Errorf("%w: must be a whole number of minutes", ErrInvalidRuntimeFormat)
+	}
+
+	if strings.HasPrefix(strings.ToUpper(value), "P") {
+		parts := runtimeISO8601RX.FindStringSubmatch(strings.ToUpper(value))
+		if parts == nil || (parts[1] == "" && parts[2] == "" && parts[3] == "") {
+			return 0, fmt.Errorf(`%w: ISO 8601 durations must use hours and minutes only, such as "PT1H42M"`, ErrInvalidRuntimeFormat)
+		}
+		if parts[3] != "" && parts[3] != "0" {
+			return 0, fmt.Errorf("%w: must be a whole number of minutes", ErrInvalidRuntimeFormat)
+		}
+		return hoursAndMinutes(parts[1], parts[2])
+	}
+
+	parts := runtimeHoursMinutesRX.FindStringSubmatch(strings.ToLower(value))
+	if parts == nil || (parts[1] == "" && parts[2] == "") {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRuntimeFormat, runtimeFormatsHint)
+	}
+	return hoursAndMinutes(parts[1], parts[2])
+}
+
+func hoursAndMinutes(hours, minutes string) (int64, error) {
+	var total int64
+
+	if hours != "" {
+		h, err := strconv.ParseInt(hours, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%w: too many hours", ErrInvalidRuntimeFormat)
+		}
+		total += h * 60
+	}
+	if minutes != "" {
+		m, err := strconv.ParseInt(minutes, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%w: too many minutes", ErrInvalidRuntimeFormat)
+		}
+		total += m
+	}
+
+	if total > 1<<31-1 {
+		return 0, fmt.Errorf("%w: too long", ErrInvalidRuntimeFormat)
+	}
+	return total, nil
+}
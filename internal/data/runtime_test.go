@@ -0,0 +1,114 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Runtime
+	}{
+		{input: `102`, want: 102},
+		{input: `"102"`, want: 102},
+		{input: `"102 mins"`, want: 102},
+		{input: `"102mins"`, want: 102},
+		{input: `"1 min"`, want: 1},
+		{input: `" 102 mins "`, want: 102},
+		{input: `"1h 42m"`, want: 102},
+		{input: `"1h42m"`, want: 102},
+		{input: `"1 hr 42 mins"`, want: 102},
+		{input: `"2 hours 5 minutes"`, want: 125},
+		{input: `"1H 42M"`, want: 102},
+		{input: `"2h"`, want: 120},
+		{input: `"42m"`, want: 42},
+		{input: `"PT1H42M"`, want: 102},
+		{input: `"pt1h42m"`, want: 102},
+		{input: `"PT2H"`, want: 120},
+		{input: `"PT42M"`, want: 42},
+		{input: `"PT1H42M0S"`, want: 102},
+		{input: `"PT90M"`, want: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got Runtime
+
+			err := got.UnmarshalJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeUnmarshalJSONRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty string", input: `""`},
+		{name: "blank string", input: `"   "`},
+		{name: "fraction", input: `102.5`},
+		{name: "fraction in string", input: `"102.5 mins"`},
+		{name: "unknown unit", input: `"102 secs"`},
+		{name: "words", input: `"feature length"`},
+		{name: "units without numbers", input: `"h m"`},
+		{name: "ISO 8601 without time", input: `"PT"`},
+		{name: "ISO 8601 days", input: `"P1DT2H"`},
+		{name: "ISO 8601 seconds", input: `"PT1H42M30S"`},
+		{name: "ISO 8601 fractions", input: `"PT1.5H"`},
+		{name: "unterminated string", input: `"102`},
+		{name: "too many hours", input: `"99999999999h"`},
+		{name: "too long", input: `"PT35791395H"`},
+		{name: "overflowing minutes", input: `99999999999`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Runtime
+
+			err := got.UnmarshalJSON([]byte(tt.input))
+			if !errors.Is(err, ErrInvalidRuntimeFormat) {
+				t.Errorf("got %d, %v; want ErrInvalidRuntimeFormat", got, err)
+			}
+		})
+	}
+}
+
+func TestRuntimeMarshalJSONFormat(t *testing.T) {
+	tests := []struct {
+		runtime Runtime
+		format  RuntimeFormat
+		want    string
+	}{
+		{runtime: 102, format: "", want: `"102 mins"`},
+		{runtime: 102, format: RuntimeMins, want: `"102 mins"`},
+		{runtime: 102, format: RuntimeMinutes, want: `102`},
+		{runtime: 102, format: RuntimeISO8601, want: `"PT1H42M"`},
+		{runtime: 120, format: RuntimeISO8601, want: `"PT2H"`},
+		{runtime: 42, format: RuntimeISO8601, want: `"PT42M"`},
+		{runtime: 0, format: RuntimeISO8601, want: `"PT0M"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+tt.want, func(t *testing.T) {
+			got, err := tt.runtime.MarshalJSONFormat(tt.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+
+			var parsed Runtime
+			if err := parsed.UnmarshalJSON(got); err != nil || parsed != tt.runtime {
+				t.Errorf("%s parsed back as %d, %v; want %d", got, parsed, err, tt.runtime)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type MovieStats struct {
+	Total   int64          `json:"total"`
+	Genres  []FacetBucket  `json:"genres"`
+	Years   []FacetBucket  `json:"years"`
+	Decades []FacetBucket  `json:"decades"`
+	Runtime RuntimeSummary `json:"runtime"`
+	// RefreshedAt is when the statistics were computed, if they were read
+	// from the movie_stats materialized view rather than computed on demand.
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+}
+
+// RuntimeSummary describes the spread of runtimes. The average and median
+// are rounded to the nearest minute.
+type RuntimeSummary struct {
+	Min    Runtime `json:"min"`
+	Avg    Runtime `json:"avg"`
+	Median Runtime `json:"median"`
+	Max    Runtime `json:"max"`
+	// Format is the format the runtimes are written in, or empty for the
+	// default.
+	Format RuntimeFormat `json:"-"`
+}
+
+// MarshalJSON writes the runtimes in Format.
+func (s RuntimeSummary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Min    formattedRuntime `json:"min"`
+		Avg    formattedRuntime `json:"avg"`
+		Median formattedRuntime `json:"median"`
+		Max    formattedRuntime `json:"max"`
+	}{
+		formattedRuntime{s.Min, s.Format},
+		formattedRuntime{s.Avg, s.Format},
+		formattedRuntime{s.Median, s.Format},
+		formattedRuntime{s.Max, s.Format},
+	})
+}
+
+// movieStatsColumns computes MovieStats over the movies in a CTE named
+// "matching". It must be kept in step with the movie_stats view.
+const movieStatsColumns = `
+				count(*),
+				COALESCE(min(runtime), 0),
+				COALESCE(round(avg(runtime)), 0),
+				COALESCE(round(percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime)), 0),
+				COALESCE(max(runtime), 0),
+				(SELECT COALESCE(json_agg(json_build_object('value', genre, 'count', n) ORDER BY n DESC, genre), '[]')
+					FROM (SELECT genre, count(*) AS n FROM matching, unnest(genres) AS genre GROUP BY genre) AS genres),
+				(SELECT COALESCE(json_agg(json_build_object('value', year::text, 'count', n) ORDER BY year), '[]')
+					FROM (SELECT year, count(*) AS n FROM matching GROUP BY year) AS years),
+				(SELECT COALESCE(json_agg(json_build_object('value', (decade * 10)::text || 's', 'count', n) ORDER BY decade), '[]')
+					FROM (SELECT year / 10 AS decade, count(*) AS n FROM matching GROUP BY year / 10) AS decades)`
+
+// isZero reports whether no filter is applied.
+func (f MovieFilters) isZero() bool {
+	return f.Title == "" && len(f.Genres) == 0 && len(f.ExcludeGenres) == 0 &&
+		f.YearMin == 0 && f.YearMax == 0 && f.RuntimeMin == 0 && f.RuntimeMax == 0 && f.PersonID == 0
+}
+
+// Stats returns statistics over the movies matching criteria. Without any
+// criteria they are read from the movie_stats view, which may be up to one
+// refresh interval old; otherwise they are computed on demand.
+func (m MovieModel) Stats(criteria MovieFilters) (*MovieStats, error) {
+	var stats MovieStats
+	var genres, years, decades []byte
+
+	dest := []interface{}{
+		&stats.Total,
+		&stats.Runtime.Min,
+		&stats.Runtime.Avg,
+		&stats.Runtime.Median,
+		&stats.Runtime.Max,
+		&genres,
+		&years,
+		&decades,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	if criteria.isZero() {
+		query := `
+				SELECT total, runtime_min, runtime_avg, runtime_median, runtime_max, genres, years, decades, refreshed_at
+				FROM movie_stats`
+
+		stats.RefreshedAt = new(time.Time)
+		err = m.DB.QueryRowContext(ctx, query).Scan(append(dest, stats.RefreshedAt)...)
+	} else {
+		query := fmt.Sprintf(`
+				WITH matching AS (
+					SELECT genres, year, runtime FROM movies WHERE %s
+				)
+				SELECT %s
+				FROM matching`, m.filterConditions(), movieStatsColumns)
+
+		err = m.DB.QueryRowContext(ctx, query, criteria.args()...).Scan(dest...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, buckets := range []struct {
+		js  []byte
+		dst *[]FacetBucket
+	}{{genres, &stats.Genres}, {years, &stats.Years}, {decades, &stats.Decades}} {
+		err = json.Unmarshal(buckets.js, buckets.dst)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &stats, nil
+}
+
+// RefreshStats recomputes the movie_stats view without blocking readers.
+func (m MovieModel) RefreshStats() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY movie_stats`)
+	return err
+}
@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LidoHon/LetsGOFurther-Greenlight.git/internal/validator"
+	"github.com/lib/pq"
+)
+
+// LocaleRX matches a lower case BCP 47 language tag such as "fr" or "pt-br".
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+type MovieTranslation struct {
+	MovieID int64  `json:"movie_id"`
+	Locale  string `json:"locale"`
+	Title   string `json:"title"`
+}
+
+func ValidateMovieTranslation(v *validator.Validator, translation *MovieTranslation) {
+	v.Check(validator.Matches(translation.Locale, LocaleRX), "locale", "must be a valid language tag, such as fr or pt-BR")
+	v.Check(translation.Title != "", "title", "must be provided")
+	v.Check(len(translation.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
+
+// MatchLocale picks the best of the available locales for a list of language
+// preferences, most preferred first. A preference matches a locale with the
+// same tag, then one for its base language, then any regional variant of its
+// base language. All tags are expected in lower case.
+func MatchLocale(preferences, available []string) (string, bool) {
+	for _, preference := range preferences {
+		base, _, _ := strings.Cut(preference, "-")
+
+		for _, candidate := range []string{preference, base} {
+			if validator.In(candidate, available...) {
+				return candidate, true
+			}
+		}
+		for _, locale := range available {
+			if strings.HasPrefix(locale, base+"-") {
+				return locale, true
+			}
+		}
+	}
+	return "", false
+}
+
+type MovieTranslationModel struct {
+	DB *sql.DB
+}
+
+func (m MovieTranslationModel) GetAllForMovie(movieID int64) ([]*MovieTranslation, error) {
+	query := `
+			SELECT movie_id, locale, title
+			FROM movie_translations
+			WHERE movie_id = $1
+			ORDER BY locale`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*MovieTranslation{}
+
+	for rows.Next() {
+		var translation MovieTranslation
+		err := rows.Scan(&translation.MovieID, &translation.Locale, &translation.Title)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, &translation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
+
+// Put adds or replaces a translation. As the translation changes how the
+// movie is presented, the movie's version is bumped and a revision recorded,
+// attributed to userID, unless the translation was already there unchanged.
+// It returns the version of the movie.
+func (m MovieTranslationModel) Put(translation *MovieTranslation, userID int64) (int32, error) {
+	query := `
+			WITH translation AS (
+				INSERT INTO movie_translations (movie_id, locale, title)
+				SELECT id, $2, $3 FROM movies WHERE id = $1 AND deleted_at IS NULL
+				ON CONFLICT (movie_id, locale) DO UPDATE SET title = EXCLUDED.title
+					WHERE movie_translations.title <> EXCLUDED.title
+				RETURNING movie_id
+			), changed AS (
+				UPDATE movies SET version = version + 1
+				WHERE id = (SELECT movie_id FROM translation)
+				RETURNING id, title, year, runtime, genres, version, poster
+			), ` + recordRevision(4) + `
+			SELECT version FROM changed
+			UNION ALL
+			SELECT version FROM movies
+			WHERE id = $1 AND deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM translation)`
+
+	var version int32
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, translation.MovieID, translation.Locale, translation.Title, userID).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// Delete removes a translation, bumping the movie's version like Put. It
+// returns ErrRecordNotFound, and leaves the movie alone, if there is no such
+// translation.
+func (m MovieTranslationModel) Delete(movieID int64, locale string, userID int64) error {
+	query := `
+			WITH translation AS (
+				DELETE FROM movie_translations
+				WHERE movie_id = $1 AND locale = $2
+				AND movie_id IN (SELECT id FROM movies WHERE deleted_at IS NULL)
+				RETURNING movie_id
+			), changed AS (
+				UPDATE movies SET version = version + 1
+				WHERE id = (SELECT movie_id FROM translation)
+				RETURNING id, title, year, runtime, genres, version, poster
+			), ` + recordRevision(3) + `
+			SELECT version FROM changed`
+
+	var version int32
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, locale, userID).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Localise replaces the titles of the given movies with the translation best
+// matching the language preferences, keeping the original title in
+// OriginalTitle. Movies without a matching translation are left alone.
+func (m MovieTranslationModel) Localise(movies []*Movie, preferences []string) error {
+	if len(movies) == 0 || len(preferences) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	bases := make([]string, len(preferences))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	for i, preference := range preferences {
+		bases[i], _, _ = strings.Cut(preference, "-")
+	}
+
+	query := `
+			SELECT movie_id, locale, title
+			FROM movie_translations
+			WHERE movie_id = ANY($1) AND split_part(locale, '-', 1) = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), pq.Array(bases))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	titles := make(map[int64]map[string]string)
+
+	for rows.Next() {
+		var translation MovieTranslation
+		err := rows.Scan(&translation.MovieID, &translation.Locale, &translation.Title)
+		if err != nil {
+			return err
+		}
+		if titles[translation.MovieID] == nil {
+			titles[translation.MovieID] = make(map[string]string)
+		}
+		titles[translation.MovieID][translation.Locale] = translation.Title
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		available := make([]string, 0, len(titles[movie.ID]))
+		for locale := range titles[movie.ID] {
+			available = append(available, locale)
+		}
+		sort.Strings(available)
+
+		locale, ok := MatchLocale(preferences, available)
+		if !ok || movie.Title == "" {
+			continue
+		}
+		movie.OriginalTitle = movie.Title
+		movie.Title = titles[movie.ID][locale]
+		movie.Locale = locale
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type WatchlistEntry struct {
+	Movie   *Movie    `json:"movie"`
+	Watched bool      `json:"watched"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Put adds a movie to a user's watchlist, or updates the watched state of the
+// entry when the movie is already on it. A nil watched leaves the state of an
+// existing entry alone. It reports whether a new entry was created.
+func (m WatchlistModel) Put(userID, movieID int64, watched *bool) (*WatchlistEntry, bool, error) {
+	query := `
+			INSERT INTO watchlist (user_id, movie_id, watched)
+			VALUES ($1, $2, COALESCE($3, false))
+			ON CONFLICT (user_id, movie_id) DO UPDATE SET watched = COALESCE($3, watchlist.watched)
+			RETURNING watched, added_at, xmax = 0`
+
+	entry := WatchlistEntry{Movie: &Movie{ID: movieID}}
+	var created bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID, watched).Scan(&entry.Watched, &entry.AddedAt, &created)
+	if err != nil {
+		return nil, false, err
+	}
+	return &entry, created, nil
+}
+
+func (m WatchlistModel) Delete(userID, movieID int64) error {
+	query := `DELETE FROM watchlist WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForUser lists the movies on a user's watchlist. Movies in the trash
+// are left out until they are restored.
+func (m WatchlistModel) GetAllForUser(userID int64, filters Filters) ([]*WatchlistEntry, Metadata, error) {
+	table := "movies"
+	if filters.sortColumn() == "added_at" {
+		table = "watchlist"
+	}
+
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), watchlist.watched, watchlist.added_at,
+				movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+				movies.average_rating, movies.rating_count
+			FROM watchlist
+			INNER JOIN movies ON movies.id = watchlist.movie_id
+			WHERE watchlist.user_id = $1 AND movies.deleted_at IS NULL
+			ORDER BY %s.%s %s, movies.id ASC
+			LIMIT $2 OFFSET $3`, table, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*WatchlistEntry{}
+
+	for rows.Next() {
+		entry := WatchlistEntry{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&entry.Watched,
+			&entry.AddedAt,
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Version,
+			&entry.Movie.AverageRating,
+			&entry.Movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return entries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,216 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+const movie = `{"genres":["drama","crime"],"id":1,"title":"Heat","year":1995}`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace member",
+			patch: `[{"op":"replace","path":"/title","value":"Heat (1995)"}]`,
+			want:  `{"genres":["drama","crime"],"id":1,"title":"Heat (1995)","year":1995}`,
+		},
+		{
+			name:  "add member",
+			patch: `[{"op":"add","path":"/runtime","value":170}]`,
+			want:  `{"genres":["drama","crime"],"id":1,"runtime":170,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "add replaces existing member",
+			patch: `[{"op":"add","path":"/year","value":1996}]`,
+			want:  `{"genres":["drama","crime"],"id":1,"title":"Heat","year":1996}`,
+		},
+		{
+			name:  "remove member",
+			patch: `[{"op":"remove","path":"/year"}]`,
+			want:  `{"genres":["drama","crime"],"id":1,"title":"Heat"}`,
+		},
+		{
+			name:  "append to array",
+			patch: `[{"op":"add","path":"/genres/-","value":"thriller"}]`,
+			want:  `{"genres":["drama","crime","thriller"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "insert into array",
+			patch: `[{"op":"add","path":"/genres/0","value":"thriller"}]`,
+			want:  `{"genres":["thriller","drama","crime"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "insert at end of array",
+			patch: `[{"op":"add","path":"/genres/2","value":"thriller"}]`,
+			want:  `{"genres":["drama","crime","thriller"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "replace array element",
+			patch: `[{"op":"replace","path":"/genres/1","value":"thriller"}]`,
+			want:  `{"genres":["drama","thriller"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "remove array element",
+			patch: `[{"op":"remove","path":"/genres/0"}]`,
+			want:  `{"genres":["crime"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "passing test",
+			patch: `[{"op":"test","path":"/id","value":1},{"op":"replace","path":"/year","value":1996}]`,
+			want:  `{"genres":["drama","crime"],"id":1,"title":"Heat","year":1996}`,
+		},
+		{
+			name:  "escaped pointer tokens",
+			patch: `[{"op":"add","path":"/a~1b~0c","value":true}]`,
+			want:  `{"a/b~c":true,"genres":["drama","crime"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "replace whole document",
+			patch: `[{"op":"replace","path":"","value":{"id":2}}]`,
+			want:  `{"id":2}`,
+		},
+		{
+			name:  "empty patch",
+			patch: `[]`,
+			want:  movie,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(movie), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		patch      string
+		testFailed bool
+	}{
+		{name: "not an array", patch: `{"op":"remove","path":"/year"}`},
+		{name: "unknown field", patch: `[{"op":"remove","path":"/year","from":"/id"}]`},
+		{name: "unsupported op", patch: `[{"op":"move","path":"/year"}]`},
+		{name: "missing value", patch: `[{"op":"replace","path":"/year"}]`},
+		{name: "path without slash", patch: `[{"op":"replace","path":"year","value":1996}]`},
+		{name: "replace missing member", patch: `[{"op":"replace","path":"/runtime","value":170}]`},
+		{name: "remove missing member", patch: `[{"op":"remove","path":"/runtime"}]`},
+		{name: "add below missing member", patch: `[{"op":"add","path":"/poster/url","value":"x"}]`},
+		{name: "path through scalar", patch: `[{"op":"add","path":"/year/month","value":1}]`},
+		{name: "array index out of bounds", patch: `[{"op":"replace","path":"/genres/2","value":"thriller"}]`},
+		{name: "insert past end of array", patch: `[{"op":"add","path":"/genres/3","value":"thriller"}]`},
+		{name: "negative array index", patch: `[{"op":"remove","path":"/genres/-1"}]`},
+		{name: "array index with leading zero", patch: `[{"op":"remove","path":"/genres/01"}]`},
+		{name: "array index not a number", patch: `[{"op":"remove","path":"/genres/first"}]`},
+		{name: "remove whole document", patch: `[{"op":"remove","path":""}]`},
+		{name: "test missing member", patch: `[{"op":"test","path":"/runtime","value":170}]`},
+		{name: "failing test", patch: `[{"op":"test","path":"/id","value":2}]`, testFailed: true},
+		{name: "failing test after change", patch: `[{"op":"replace","path":"/id","value":2},{"op":"test","path":"/id","value":1}]`, testFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(movie), []byte(tt.patch))
+			if err == nil {
+				t.Fatalf("got %s; want an error", got)
+			}
+			if errors.Is(err, ErrTestFailed) != tt.testFailed {
+				t.Errorf("got error %q; want ErrTestFailed to be %t", err, tt.testFailed)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace member",
+			doc:   movie,
+			patch: `{"title":"Heat (1995)"}`,
+			want:  `{"genres":["drama","crime"],"id":1,"title":"Heat (1995)","year":1995}`,
+		},
+		{
+			name:  "remove member",
+			doc:   movie,
+			patch: `{"year":null}`,
+			want:  `{"genres":["drama","crime"],"id":1,"title":"Heat"}`,
+		},
+		{
+			name:  "arrays are replaced",
+			doc:   movie,
+			patch: `{"genres":["thriller"]}`,
+			want:  `{"genres":["thriller"],"id":1,"title":"Heat","year":1995}`,
+		},
+		{
+			name:  "nested objects are merged",
+			doc:   `{"a":{"b":1,"c":2}}`,
+			patch: `{"a":{"b":null,"d":3}}`,
+			want:  `{"a":{"c":2,"d":3}}`,
+		},
+		{
+			name:  "object replaces scalar",
+			doc:   `{"a":1}`,
+			patch: `{"a":{"b":null,"c":2}}`,
+			want:  `{"a":{"c":2}}`,
+		},
+		{
+			name:  "non-object patch replaces document",
+			doc:   movie,
+			patch: `["drama"]`,
+			want:  `["drama"]`,
+		},
+		{
+			name:  "empty patch",
+			doc:   movie,
+			patch: `{}`,
+			want:  movie,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{name: "empty", patch: ``},
+		{name: "malformed", patch: `{"title":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge([]byte(movie), []byte(tt.patch))
+			if err == nil {
+				t.Errorf("got %s; want an error", got)
+			}
+		})
+	}
+}
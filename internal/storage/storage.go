@@ -0,0 +1,24 @@
+// Package storage keeps uploaded files, such as movie posters, behind an
+// interface so the backend holding them can be swapped out.
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Storage stores files under slash separated keys.
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing file.
+	Put(key string, r io.Reader) error
+	// Open returns the file stored under key and when it was last modified.
+	// It returns ErrNotFound if there is no such file.
+	Open(key string) (io.ReadSeekCloser, time.Time, error)
+	// Delete removes the file stored under key along with every file whose
+	// key starts with key followed by a slash. Deleting a missing key is not
+	// an error.
+	Delete(key string) error
+}
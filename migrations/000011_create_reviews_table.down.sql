@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS reviews_refresh_movie_rating ON reviews;
+DROP FUNCTION IF EXISTS refresh_movie_rating();
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS average_rating;
+DROP TABLE IF EXISTS reviews;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS reviews (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    score integer NOT NULL CHECK (score BETWEEN 1 AND 10),
+    body text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (movie_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx ON reviews (user_id);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS average_rating numeric(4, 2);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+
+-- Keep the denormalised rating columns on movies in step with its reviews.
+CREATE OR REPLACE FUNCTION refresh_movie_rating() RETURNS trigger AS $$
+BEGIN
+    UPDATE movies
+    SET (average_rating, rating_count) = (
+        SELECT round(avg(score), 2), count(*) FROM reviews WHERE reviews.movie_id = movies.id
+    )
+    WHERE id = COALESCE(NEW.movie_id, OLD.movie_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_refresh_movie_rating
+AFTER INSERT OR UPDATE OR DELETE ON reviews
+FOR EACH ROW EXECUTE FUNCTION refresh_movie_rating();
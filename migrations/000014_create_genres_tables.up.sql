@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL UNIQUE,
+    slug text NOT NULL UNIQUE
+);
+
+-- Every genre is also listed under its own slug, so a single lookup resolves
+-- both slugs and aliases and the primary key keeps them from overlapping.
+CREATE TABLE IF NOT EXISTS genre_aliases (
+    alias text PRIMARY KEY,
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS genre_aliases_genre_id_idx ON genre_aliases (genre_id);
+
+-- Seed the catalogue from the genres already in use, taking the most common
+-- spelling of each slug as its name.
+INSERT INTO genres (name, slug)
+SELECT DISTINCT ON (slug) name, slug
+FROM (
+    SELECT genre AS name, trim(both '-' FROM regexp_replace(lower(genre), '[^[:alnum:]]+', '-', 'g')) AS slug, count(*) AS uses
+    FROM movies, unnest(genres) AS genre
+    GROUP BY genre
+) AS existing
+WHERE slug <> ''
+ORDER BY slug, uses DESC, name;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT slug, id FROM genres;
+
+WITH changed AS (
+    UPDATE movies SET genres = canonical.genres, version = movies.version + 1
+    FROM (
+        SELECT movies.id, ARRAY(
+            SELECT genres.name
+            FROM unnest(movies.genres) WITH ORDINALITY AS given(genre, position)
+            INNER JOIN genre_aliases ON genre_aliases.alias = trim(both '-' FROM regexp_replace(lower(given.genre), '[^[:alnum:]]+', '-', 'g'))
+            INNER JOIN genres ON genres.id = genre_aliases.genre_id
+            GROUP BY genres.name
+            ORDER BY min(given.position)
+        ) AS genres
+        FROM movies
+    ) AS canonical
+    WHERE movies.id = canonical.id
+        AND movies.genres <> canonical.genres
+        AND cardinality(canonical.genres) > 0
+    RETURNING movies.id, movies.version, movies.title, movies.year, movies.runtime, movies.genres
+)
+INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres)
+SELECT id, version, title, year, runtime, genres FROM changed;
+
+INSERT INTO permissions (code)
+VALUES
+    ('genres:write');
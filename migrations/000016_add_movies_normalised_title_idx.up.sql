@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS movies_normalised_title_year_idx
+ON movies (trim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g')), year)
+WHERE deleted_at IS NULL;
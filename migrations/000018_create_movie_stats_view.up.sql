@@ -0,0 +1,24 @@
+-- Statistics over the whole catalogue, outside the trash. It keeps a single
+-- row and is refreshed periodically by the API. Statistics over a filtered
+-- set of movies are computed on demand with the same query.
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_stats AS
+WITH matching AS (
+    SELECT genres, year, runtime FROM movies WHERE deleted_at IS NULL
+)
+SELECT
+    1 AS id,
+    NOW() AS refreshed_at,
+    count(*) AS total,
+    COALESCE(min(runtime), 0) AS runtime_min,
+    COALESCE(round(avg(runtime)), 0) AS runtime_avg,
+    COALESCE(round(percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime)), 0) AS runtime_median,
+    COALESCE(max(runtime), 0) AS runtime_max,
+    (SELECT COALESCE(json_agg(json_build_object('value', genre, 'count', n) ORDER BY n DESC, genre), '[]')
+        FROM (SELECT genre, count(*) AS n FROM matching, unnest(genres) AS genre GROUP BY genre) AS genres) AS genres,
+    (SELECT COALESCE(json_agg(json_build_object('value', year::text, 'count', n) ORDER BY year), '[]')
+        FROM (SELECT year, count(*) AS n FROM matching GROUP BY year) AS years) AS years,
+    (SELECT COALESCE(json_agg(json_build_object('value', (decade * 10)::text || 's', 'count', n) ORDER BY decade), '[]')
+        FROM (SELECT year / 10 AS decade, count(*) AS n FROM matching GROUP BY year / 10) AS decades) AS decades
+FROM matching;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_stats_id_idx ON movie_stats (id);
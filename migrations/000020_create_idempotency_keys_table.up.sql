@@ -0,0 +1,18 @@
+-- user_id is 0 for requests made without authenticating, such as
+-- registrations, so it cannot reference users; the keys of those requests
+-- are scoped to the client address instead, which is empty for every other
+-- request. request_hash is only known
+-- once the request body has been read, so it is NULL while a key is claimed.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id bigint NOT NULL,
+    client text NOT NULL DEFAULT '',
+    key text NOT NULL,
+    request_hash bytea,
+    status integer NOT NULL DEFAULT 0,
+    header jsonb NOT NULL DEFAULT '{}',
+    body bytea NOT NULL DEFAULT '',
+    expiry timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, client, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expiry_idx ON idempotency_keys (expiry);
@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION refresh_movie_rating() RETURNS trigger AS $$
+BEGIN
+    UPDATE movies
+    SET (average_rating, rating_count) = (
+        SELECT round(avg(score), 2), count(*) FROM reviews WHERE reviews.movie_id = movies.id
+    )
+    WHERE id = COALESCE(NEW.movie_id, OLD.movie_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
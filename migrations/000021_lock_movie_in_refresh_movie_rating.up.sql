@@ -0,0 +1,25 @@
+-- Recompute the rating of every movie a review row belonged to before or after
+-- the change, since moving reviews between movies changes both. Each movie is
+-- locked before its reviews are read, so of two reviews written at the same
+-- time the second trigger waits for the first transaction and then counts
+-- both.
+CREATE OR REPLACE FUNCTION refresh_movie_rating() RETURNS trigger AS $$
+DECLARE
+    rated_movie_id bigint;
+BEGIN
+    FOR rated_movie_id IN
+        SELECT DISTINCT id FROM unnest(ARRAY[OLD.movie_id, NEW.movie_id]) AS id
+        WHERE id IS NOT NULL
+        ORDER BY id
+    LOOP
+        PERFORM 1 FROM movies WHERE id = rated_movie_id FOR UPDATE;
+
+        UPDATE movies
+        SET (average_rating, rating_count) = (
+            SELECT round(avg(score), 2), count(*) FROM reviews WHERE reviews.movie_id = movies.id
+        )
+        WHERE id = rated_movie_id;
+    END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
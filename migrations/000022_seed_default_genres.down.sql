@@ -0,0 +1,11 @@
+-- Seeded genres are only removed if no movie has been filed under them.
+-- Grants of genres:write are kept, as they cannot be told apart from those
+-- made since.
+DELETE FROM genres
+WHERE slug IN (
+    'action', 'adventure', 'animation', 'biography', 'comedy', 'crime',
+    'documentary', 'drama', 'family', 'fantasy', 'history', 'horror', 'music',
+    'musical', 'mystery', 'romance', 'sci-fi', 'sport', 'thriller', 'war',
+    'western'
+)
+AND NOT EXISTS (SELECT 1 FROM movies WHERE genres.name = ANY(movies.genres));
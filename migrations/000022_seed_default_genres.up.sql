@@ -0,0 +1,31 @@
+-- Seed the catalogue with common genres, so movies can be created on a fresh
+-- database. Genres already in the catalogue, under their name or slug, are
+-- left as they are.
+INSERT INTO genres (name, slug)
+SELECT name, trim(both '-' FROM regexp_replace(lower(name), '[^[:alnum:]]+', '-', 'g'))
+FROM unnest(ARRAY[
+    'Action', 'Adventure', 'Animation', 'Biography', 'Comedy', 'Crime',
+    'Documentary', 'Drama', 'Family', 'Fantasy', 'History', 'Horror', 'Music',
+    'Musical', 'Mystery', 'Romance', 'Sci-Fi', 'Sport', 'Thriller', 'War',
+    'Western'
+]) AS name
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT slug, id FROM genres
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT alias, genres.id
+FROM (VALUES ('science-fiction', 'sci-fi'), ('scifi', 'sci-fi'), ('biopic', 'biography'), ('sports', 'sport')) AS aliases (alias, slug)
+INNER JOIN genres ON genres.slug = aliases.slug
+ON CONFLICT DO NOTHING;
+
+-- Anyone who can edit movies can look after the genres they are filed under.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, genres_write.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'genres:write') AS genres_write
+WHERE permissions.code = 'movies:write'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS poster text NOT NULL DEFAULT '';
+
+-- Only the poster a movie has now is known, so it is filled in on its
+-- current revision.
+UPDATE movie_revisions SET poster = movies.poster
+FROM movies
+WHERE movie_revisions.movie_id = movies.id AND movie_revisions.version = movies.version;